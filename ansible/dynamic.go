@@ -0,0 +1,71 @@
+package ansible
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// DynamicHost is a host of a dynamic inventory.
+type DynamicHost struct {
+	Name   string
+	Groups []string
+	Vars   map[string]any
+}
+
+type dynamicGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+// WriteDynamic writes hosts as the JSON printed by dynamic inventory
+// scripts for --list. Host variables are included in _meta, so Ansible does
+// not need to call the script for each host.
+func WriteDynamic(w io.Writer, hosts []DynamicHost) error {
+	hostVars := make(map[string]map[string]any, len(hosts))
+	groups := make(map[string]*dynamicGroup)
+
+	addHost := func(group, host string) {
+		g, ok := groups[group]
+		if !ok {
+			g = &dynamicGroup{}
+			groups[group] = g
+		}
+
+		g.Hosts = append(g.Hosts, host)
+	}
+
+	for _, host := range hosts {
+		vars := host.Vars
+		if vars == nil {
+			vars = make(map[string]any)
+		}
+		hostVars[host.Name] = vars
+
+		if len(host.Groups) == 0 {
+			addHost(GroupUngrouped, host.Name)
+		}
+
+		for _, group := range host.Groups {
+			addHost(group, host.Name)
+		}
+	}
+
+	all := &dynamicGroup{Children: make([]string, 0, len(groups))}
+	for name := range groups {
+		all.Children = append(all.Children, name)
+	}
+	sort.Strings(all.Children)
+
+	out := make(map[string]any, len(groups)+2)
+	out["_meta"] = map[string]any{"hostvars": hostVars}
+	out[GroupAll] = all
+	for name, g := range groups {
+		out[name] = g
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(out)
+}
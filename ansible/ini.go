@@ -0,0 +1,216 @@
+package ansible
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseINI parses an inventory in the INI format:
+//
+//	host0 ansible_host=10.0.0.1
+//
+//	[web]
+//	web[01:03].example.com ansible_user=deploy
+//
+//	[web:vars]
+//	ansible_port=2222
+//
+//	[prod:children]
+//	web
+//
+// Hosts before the first section are ungrouped.
+func ParseINI(r io.Reader) (*Inventory, error) {
+	inv := newInventory()
+
+	group, kind := GroupUngrouped, "hosts"
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %q", n, line)
+			}
+
+			group, kind, _ = strings.Cut(line[1:len(line)-1], ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+
+			switch kind {
+			case "hosts", "vars", "children":
+			default:
+				return nil, fmt.Errorf("line %d: invalid section type %q", n, kind)
+			}
+
+			inv.group(group)
+			continue
+		}
+
+		switch kind {
+		case "hosts":
+			fields, err := splitFields(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+
+			vars, err := parseVars(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+
+			hosts, err := expandHostPattern(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+
+			for _, host := range hosts {
+				inv.addHost(group, host, vars)
+			}
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", n, line)
+			}
+
+			inv.group(group).Vars[strings.TrimSpace(key)] = unquote(stripComment(strings.TrimSpace(value)))
+		case "children":
+			inv.addChild(group, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	inv.fixUngrouped()
+
+	return inv, nil
+}
+
+// fixUngrouped removes the hosts that are in other groups from the
+// ungrouped group.
+func (inv *Inventory) fixUngrouped() {
+	g := inv.groups[GroupUngrouped]
+	if g == nil {
+		return
+	}
+
+	grouped := make(map[string]bool)
+	for name, other := range inv.groups {
+		if name == GroupUngrouped || name == GroupAll {
+			continue
+		}
+
+		for _, h := range other.Hosts {
+			grouped[h] = true
+		}
+	}
+
+	hosts := g.Hosts[:0]
+	for _, h := range g.Hosts {
+		if !grouped[h] {
+			hosts = append(hosts, h)
+		}
+	}
+
+	g.Hosts = hosts
+}
+
+// splitFields splits a host line into fields separated by whitespace, keeping
+// quoted values together.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote byte
+	inField := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			field.WriteByte(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inField = true
+			field.WriteByte(c)
+		case c == '#':
+			if !inField {
+				i = len(line)
+				continue
+			}
+			field.WriteByte(c)
+		case c == ' ' || c == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			inField = true
+			field.WriteByte(c)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+func parseVars(fields []string) (map[string]string, error) {
+	vars := make(map[string]string, len(fields))
+	for _, f := range fields {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected KEY=VALUE, got %q", f)
+		}
+
+		vars[key] = unquote(value)
+	}
+
+	return vars, nil
+}
+
+// stripComment removes a comment following an unquoted value.
+func stripComment(value string) string {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end != -1 {
+			return value[:end+2]
+		}
+
+		return value
+	}
+
+	if i := strings.Index(value, " #"); i != -1 {
+		value = value[:i]
+	}
+	if i := strings.Index(value, "\t#"); i != -1 {
+		value = value[:i]
+	}
+
+	return strings.TrimSpace(value)
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
@@ -0,0 +1,259 @@
+// Package ansible reads Ansible inventories and writes dynamic inventories.
+package ansible
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inventory is an Ansible inventory: hosts organized in groups, with
+// variables set on hosts and groups.
+type Inventory struct {
+	// Hosts are the host names in the order they first appear.
+	Hosts    []string
+	hostVars map[string]map[string]string
+	groups   map[string]*Group
+}
+
+// Group is a group of an inventory.
+type Group struct {
+	Name     string
+	Hosts    []string
+	Children []string
+	Vars     map[string]string
+}
+
+const (
+	// GroupAll contains all hosts.
+	GroupAll = "all"
+	// GroupUngrouped contains the hosts that are in no other group than all.
+	GroupUngrouped = "ungrouped"
+)
+
+func newInventory() *Inventory {
+	return &Inventory{
+		hostVars: make(map[string]map[string]string),
+		groups:   make(map[string]*Group),
+	}
+}
+
+// ParseFile parses the inventory at path. Files ending in .yml or .yaml are
+// read as YAML inventories, other files as INI inventories.
+func ParseFile(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var inv *Inventory
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		inv, err = ParseYAML(f)
+	default:
+		inv, err = ParseINI(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return inv, nil
+}
+
+func (inv *Inventory) group(name string) *Group {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &Group{Name: name, Vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+
+	return g
+}
+
+// addHost adds host to group and sets vars on it.
+func (inv *Inventory) addHost(group, host string, vars map[string]string) {
+	hv, ok := inv.hostVars[host]
+	if !ok {
+		hv = make(map[string]string)
+		inv.hostVars[host] = hv
+		inv.Hosts = append(inv.Hosts, host)
+	}
+
+	for k, v := range vars {
+		hv[k] = v
+	}
+
+	g := inv.group(group)
+	for _, h := range g.Hosts {
+		if h == host {
+			return
+		}
+	}
+
+	g.Hosts = append(g.Hosts, host)
+}
+
+func (inv *Inventory) addChild(group, child string) {
+	g := inv.group(group)
+	inv.group(child)
+
+	for _, c := range g.Children {
+		if c == child {
+			return
+		}
+	}
+
+	g.Children = append(g.Children, child)
+}
+
+// HostGroups returns the groups host belongs to, directly or through child
+// groups, sorted by depth and name. all comes first.
+func (inv *Inventory) HostGroups(host string) []string {
+	depth := make(map[string]int)
+
+	var visit func(name string, d int) bool
+	visit = func(name string, d int) bool {
+		if d > len(inv.groups) {
+			return false
+		}
+
+		g := inv.groups[name]
+		if g == nil {
+			return false
+		}
+
+		member := false
+		for _, h := range g.Hosts {
+			if h == host {
+				member = true
+			}
+		}
+		for _, child := range g.Children {
+			if visit(child, d+1) {
+				member = true
+			}
+		}
+
+		if member {
+			depth[name] = max(depth[name], d)
+		}
+
+		return member
+	}
+
+	for name := range inv.groups {
+		visit(name, 1)
+	}
+
+	groups := []string{GroupAll}
+	for name := range depth {
+		if name != GroupAll {
+			groups = append(groups, name)
+		}
+	}
+
+	sort.SliceStable(groups[1:], func(i, j int) bool {
+		a, b := groups[i+1], groups[j+1]
+		if depth[a] != depth[b] {
+			return depth[a] < depth[b]
+		}
+
+		return a < b
+	})
+
+	return groups
+}
+
+// HostVars returns the variables of host, merging the variables of its
+// groups like Ansible: all, then parent groups before child groups, then the
+// host variables.
+func (inv *Inventory) HostVars(host string) map[string]string {
+	vars := make(map[string]string)
+
+	for _, name := range inv.HostGroups(host) {
+		if g := inv.groups[name]; g != nil {
+			for k, v := range g.Vars {
+				vars[k] = v
+			}
+		}
+	}
+
+	for k, v := range inv.hostVars[host] {
+		vars[k] = v
+	}
+
+	return vars
+}
+
+// expandHostPattern expands the ranges of a host pattern such as
+// web[01:03].example.com or db-[a:c]. Ranges may have a stride,
+// e.g. [1:10:2].
+func expandHostPattern(pattern string) ([]string, error) {
+	start := strings.IndexByte(pattern, '[')
+	if start == -1 {
+		return []string{pattern}, nil
+	}
+
+	end := strings.IndexByte(pattern[start:], ']')
+	if end == -1 {
+		return []string{pattern}, nil
+	}
+	end += start
+
+	prefix, spec, suffix := pattern[:start], pattern[start+1:end], pattern[end+1:]
+
+	bounds := strings.Split(spec, ":")
+	if len(bounds) < 2 || len(bounds) > 3 {
+		// Not a range, e.g. an IPv6 address.
+		return []string{pattern}, nil
+	}
+
+	stride := 1
+	if len(bounds) == 3 {
+		var err error
+		if stride, err = strconv.Atoi(bounds[2]); err != nil || stride < 1 {
+			return nil, fmt.Errorf("invalid host range %q", pattern)
+		}
+	}
+
+	var items []string
+	if from, err := strconv.Atoi(bounds[0]); err == nil {
+		to, err := strconv.Atoi(bounds[1])
+		if err != nil || to < from {
+			return nil, fmt.Errorf("invalid host range %q", pattern)
+		}
+
+		width := 0
+		if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+			width = len(bounds[0])
+		}
+
+		for i := from; i <= to; i += stride {
+			items = append(items, fmt.Sprintf("%0*d", width, i))
+		}
+	} else if len(bounds[0]) == 1 && len(bounds[1]) == 1 && bounds[0] <= bounds[1] {
+		for c := int(bounds[0][0]); c <= int(bounds[1][0]); c += stride {
+			items = append(items, string(rune(c)))
+		}
+	} else {
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+
+	rest, err := expandHostPattern(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, item := range items {
+		for _, r := range rest {
+			hosts = append(hosts, prefix+item+r)
+		}
+	}
+
+	return hosts, nil
+}
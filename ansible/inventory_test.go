@@ -0,0 +1,296 @@
+package ansible
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandHostPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"web", []string{"web"}},
+		{"web[01:03].example.com", []string{"web01.example.com", "web02.example.com", "web03.example.com"}},
+		{"web[8:10]", []string{"web8", "web9", "web10"}},
+		{"db[1:10:3]", []string{"db1", "db4", "db7", "db10"}},
+		{"db-[a:c]", []string{"db-a", "db-b", "db-c"}},
+		{"x[1:2]y[a:b]", []string{"x1ya", "x1yb", "x2ya", "x2yb"}},
+		{"web[1]", []string{"web[1]"}},
+		{"web[1:2", []string{"web[1:2"}},
+	}
+
+	for _, tt := range tests {
+		got, err := expandHostPattern(tt.pattern)
+		if err != nil {
+			t.Errorf("expandHostPattern(%q): %v", tt.pattern, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandHostPattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"web[3:1]", "web[1:x]", "web[1:3:0]", "web[a:cc]", "web[c:a]"} {
+		if _, err := expandHostPattern(pattern); err == nil {
+			t.Errorf("expandHostPattern(%q) succeeded", pattern)
+		}
+	}
+}
+
+// hostWant is the expected groups and variables of an inventory host.
+type hostWant struct {
+	groups []string
+	vars   map[string]string
+}
+
+func checkInventory(t *testing.T, inv *Inventory, hosts []string, want map[string]hostWant) {
+	t.Helper()
+
+	if !reflect.DeepEqual(inv.Hosts, hosts) {
+		t.Errorf("Hosts = %q, want %q", inv.Hosts, hosts)
+	}
+
+	for host, w := range want {
+		if got := inv.HostGroups(host); !reflect.DeepEqual(got, w.groups) {
+			t.Errorf("HostGroups(%s) = %q, want %q", host, got, w.groups)
+		}
+
+		if got := inv.HostVars(host); !reflect.DeepEqual(got, w.vars) {
+			t.Errorf("HostVars(%s) = %v, want %v", host, got, w.vars)
+		}
+	}
+}
+
+func TestParseINI(t *testing.T) {
+	inv, err := ParseINI(strings.NewReader(`
+# Hosts before the first section are ungrouped.
+lonely ansible_host=10.0.0.9
+moved
+
+; Comments start with # or ;.
+[web]
+web[01:02].example.com ansible_user=deploy
+web-a ansible_port=2201 # comment
+moved
+
+[web:vars]
+ansible_port=2222
+ansible_user = webuser
+note="quoted # value" # comment
+
+[db]
+db[1:3:2] ansible_ssh_host='10.0.1.1' label="two words"
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=produser
+ansible_port=2000
+env=prod
+
+[all:vars]
+ansible_user=root
+env=all
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"lonely", "moved", "web01.example.com", "web02.example.com", "web-a", "db1", "db3"}
+
+	checkInventory(t, inv, hosts, map[string]hostWant{
+		"lonely": {
+			groups: []string{GroupAll, GroupUngrouped},
+			vars:   map[string]string{"ansible_host": "10.0.0.9", "ansible_user": "root", "env": "all"},
+		},
+		// A host listed in a group is not ungrouped anymore.
+		"moved": {
+			groups: []string{GroupAll, "prod", "web"},
+			vars: map[string]string{
+				"ansible_user": "webuser",
+				"ansible_port": "2222",
+				"env":          "prod",
+				"note":         "quoted # value",
+			},
+		},
+		// Host variables win over the variables of child groups, which win
+		// over those of their parents and all.
+		"web01.example.com": {
+			groups: []string{GroupAll, "prod", "web"},
+			vars: map[string]string{
+				"ansible_user": "deploy",
+				"ansible_port": "2222",
+				"env":          "prod",
+				"note":         "quoted # value",
+			},
+		},
+		"web-a": {
+			groups: []string{GroupAll, "prod", "web"},
+			vars: map[string]string{
+				"ansible_user": "webuser",
+				"ansible_port": "2201",
+				"env":          "prod",
+				"note":         "quoted # value",
+			},
+		},
+		"db3": {
+			groups: []string{GroupAll, "prod", "db"},
+			vars: map[string]string{
+				"ansible_ssh_host": "10.0.1.1",
+				"ansible_user":     "produser",
+				"ansible_port":     "2000",
+				"env":              "prod",
+				"label":            "two words",
+			},
+		},
+	})
+
+	if got, want := inv.groups["prod"].Children, []string{"web", "db"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("children of prod = %q, want %q", got, want)
+	}
+
+	if got, want := inv.groups[GroupUngrouped].Hosts, []string{"lonely"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ungrouped hosts = %q, want %q", got, want)
+	}
+}
+
+func TestParseINIInvalid(t *testing.T) {
+	for _, data := range []string{
+		"[web",
+		"[web:other]",
+		"web ansible_port",
+		"web =2222",
+		"web[3:1]",
+		`web note="unterminated`,
+		"[web:vars]\nansible_port",
+	} {
+		if _, err := ParseINI(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseINI(%q) succeeded", data)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	inv, err := ParseYAML(strings.NewReader(`
+all:
+  hosts:
+    lonely:
+      ansible_host: 10.0.0.9
+  vars:
+    ansible_user: root
+    env: all
+  children:
+    prod:
+      vars:
+        ansible_user: produser
+        env: prod
+        ports: [80, 443]
+      children:
+        web:
+          hosts:
+            web[01:02].example.com:
+              ansible_user: deploy
+            web-a:
+          vars:
+            ansible_port: 2222
+        db:
+          hosts:
+            db1:
+              ansible_host: 10.0.1.1
+              ansible_port: 2000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"lonely", "web01.example.com", "web02.example.com", "web-a", "db1"}
+
+	checkInventory(t, inv, hosts, map[string]hostWant{
+		"lonely": {
+			groups: []string{GroupAll},
+			vars:   map[string]string{"ansible_host": "10.0.0.9", "ansible_user": "root", "env": "all"},
+		},
+		"web02.example.com": {
+			groups: []string{GroupAll, "prod", "web"},
+			vars: map[string]string{
+				"ansible_user": "deploy",
+				"ansible_port": "2222",
+				"env":          "prod",
+				"ports":        "[80,443]",
+			},
+		},
+		"web-a": {
+			groups: []string{GroupAll, "prod", "web"},
+			vars: map[string]string{
+				"ansible_user": "produser",
+				"ansible_port": "2222",
+				"env":          "prod",
+				"ports":        "[80,443]",
+			},
+		},
+		"db1": {
+			groups: []string{GroupAll, "prod", "db"},
+			vars: map[string]string{
+				"ansible_host": "10.0.1.1",
+				"ansible_user": "produser",
+				"ansible_port": "2000",
+				"env":          "prod",
+				"ports":        "[80,443]",
+			},
+		},
+	})
+}
+
+func TestParseYAMLInvalid(t *testing.T) {
+	for _, data := range []string{
+		"- all",
+		"all: [web]",
+		"all:\n  other: {}",
+		"all:\n  hosts: [web]",
+		"all:\n  hosts:\n    web: [1]",
+		"all:\n  hosts:\n    web[3:1]:",
+	} {
+		if _, err := ParseYAML(strings.NewReader(data)); err == nil {
+			t.Errorf("ParseYAML(%q) succeeded", data)
+		}
+	}
+
+	inv, err := ParseYAML(strings.NewReader(""))
+	if err != nil || len(inv.Hosts) != 0 {
+		t.Errorf("ParseYAML of an empty document = %v, %v, want an empty inventory", inv, err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"hosts":      "[web]\nweb1\n",
+		"hosts.yml":  "web:\n  hosts:\n    web1:\n",
+		"hosts.YAML": "web:\n  hosts:\n    web1:\n",
+	}
+
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		inv, err := ParseFile(path)
+		if err != nil {
+			t.Errorf("ParseFile(%s): %v", name, err)
+			continue
+		}
+
+		if got, want := inv.HostGroups("web1"), []string{GroupAll, "web"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseFile(%s): groups of web1 = %q, want %q", name, got, want)
+		}
+	}
+}
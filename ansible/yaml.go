@@ -0,0 +1,160 @@
+package ansible
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseYAML parses an inventory in the YAML format:
+//
+//	all:
+//	  hosts:
+//	    host0:
+//	      ansible_host: 10.0.0.1
+//	  children:
+//	    web:
+//	      hosts:
+//	        web[01:03].example.com:
+//	      vars:
+//	        ansible_port: 2222
+//
+// Top level keys are groups, usually only all.
+func ParseYAML(r io.Reader) (*Inventory, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return newInventory(), nil
+		}
+
+		return nil, err
+	}
+
+	inv := newInventory()
+
+	if len(doc.Content) == 0 {
+		return inv, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of groups", root.Line)
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if err := inv.parseYAMLGroup(root.Content[i].Value, root.Content[i+1]); err != nil {
+			return nil, err
+		}
+	}
+
+	inv.fixUngrouped()
+
+	return inv, nil
+}
+
+func (inv *Inventory) parseYAMLGroup(name string, node *yaml.Node) error {
+	g := inv.group(name)
+
+	if isNull(node) {
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping for group %s", node.Line, name)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if isNull(value) {
+			continue
+		}
+
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: expected a mapping for %s of group %s", value.Line, key, name)
+		}
+
+		switch key {
+		case "hosts":
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				vars, err := yamlVars(value.Content[j+1])
+				if err != nil {
+					return err
+				}
+
+				hosts, err := expandHostPattern(value.Content[j].Value)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", value.Content[j].Line, err)
+				}
+
+				for _, host := range hosts {
+					inv.addHost(name, host, vars)
+				}
+			}
+		case "vars":
+			vars, err := yamlVars(value)
+			if err != nil {
+				return err
+			}
+
+			for k, v := range vars {
+				g.Vars[k] = v
+			}
+		case "children":
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				child := value.Content[j].Value
+				inv.addChild(name, child)
+
+				if err := inv.parseYAMLGroup(child, value.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("line %d: unknown key %s in group %s", node.Content[i].Line, key, name)
+		}
+	}
+
+	return nil
+}
+
+// yamlVars returns the variables of a mapping. Values that are not scalars
+// are kept as JSON.
+func yamlVars(node *yaml.Node) (map[string]string, error) {
+	vars := make(map[string]string)
+	if isNull(node) {
+		return vars, nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of variables", node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+
+		if value.Kind == yaml.ScalarNode {
+			vars[key] = value.Value
+			continue
+		}
+
+		var v any
+		if err := value.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", value.Line, err)
+		}
+
+		vars[key] = string(data)
+	}
+
+	return vars, nil
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
@@ -2,6 +2,7 @@ package archive
 
 import (
 	"archive/tar"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -147,12 +148,12 @@ func Untar(r io.Reader, dest string) error {
 }
 
 // TarRemote creates a tar archive for the given file/directory on the remote server.
-func TarRemote(exec sshexec.Executor, source string) (io.Reader, error) {
+func TarRemote(ctx context.Context, exec sshexec.Executor, source string) (io.Reader, error) {
 	outPipe, inPipe := io.Pipe()
 
 	go func() {
 		defer inPipe.Close()
-		cmd := sshexec.Command(exec, "tar", "-cf", "-", source, ".")
+		cmd := sshexec.CommandContext(ctx, exec, "tar", "-cf", "-", source, ".")
 		cmd.Stdout = inPipe
 		if err := cmd.Run(); err != nil {
 			inPipe.CloseWithError(err)
@@ -162,17 +163,17 @@ func TarRemote(exec sshexec.Executor, source string) (io.Reader, error) {
 	return outPipe, nil
 }
 
-func UntarRemote(exec sshexec.Executor, dest string, in io.Reader) error {
+func UntarRemote(ctx context.Context, exec sshexec.Executor, dest string, in io.Reader) error {
 	folderPath := filepath.Dir(dest)
 
 	// Ensure the destination directory exists
-	cmd := sshexec.Command(exec, "mkdir", "-p", folderPath)
+	cmd := sshexec.CommandContext(ctx, exec, "mkdir", "-p", folderPath)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// Untar the contents to the destination directory, replacing existing files
-	cmd = sshexec.Command(exec, "tar", "--overwrite", "-xf", "-", "-C", folderPath)
+	cmd = sshexec.CommandContext(ctx, exec, "tar", "--overwrite", "-xf", "-", "-C", folderPath)
 	cmd.Stdin = in
 
 	return cmd.Run()
@@ -0,0 +1,279 @@
+package command
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d3witt/viking/config"
+)
+
+// The password agent keeps the keys derived from master passwords in memory
+// for a limited time, so that viking asks for the master password once per
+// session instead of once per command. The first viking process unlocking an
+// encrypted config starts it in the background. It listens on a unix socket in
+// a directory only the user can access and exits once all keys expired.
+//
+// Requests and replies are single lines:
+//
+//	ping                  ok
+//	get ID                ok [SECRET]
+//	put ID SECONDS SECRET ok
+//	lock                  ok, the agent forgets all keys and exits
+//
+// Secrets are base64 encoded. Errors are replied as "error MESSAGE".
+
+const (
+	// agentTimeout limits the time spent talking to the agent.
+	agentTimeout = 2 * time.Second
+	// agentIdle is how long a started agent waits for a first key.
+	agentIdle = 10 * time.Second
+)
+
+var errAgentNotRunning = errors.New("password agent is not running")
+
+// NewPasswordAgent returns the cache keeping unlocked keys in the password
+// agent for ttl.
+func NewPasswordAgent(ttl time.Duration) config.SecretCache {
+	return passwordAgent{ttl: ttl}
+}
+
+type passwordAgent struct {
+	ttl time.Duration
+}
+
+func (a passwordAgent) Secret(id string) ([]byte, error) {
+	reply, err := agentRequest("get " + id)
+	if err != nil || reply == "" {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(reply)
+}
+
+func (a passwordAgent) CacheSecret(id string, secret []byte) error {
+	seconds := int64(a.ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	req := fmt.Sprintf("put %s %d %s", id, seconds, base64.StdEncoding.EncodeToString(secret))
+
+	if _, err := agentRequest(req); !errors.Is(err, errAgentNotRunning) {
+		return err
+	}
+
+	if err := startAgent(); err != nil {
+		return fmt.Errorf("failed to start password agent: %w", err)
+	}
+
+	_, err := agentRequest(req)
+
+	return err
+}
+
+// StopAgent makes the password agent forget all keys and exit. It reports
+// whether an agent was running.
+func StopAgent() (bool, error) {
+	_, err := agentRequest("lock")
+	if errors.Is(err, errAgentNotRunning) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// agentRequest sends req to the agent and returns the data of its reply.
+func agentRequest(req string) (string, error) {
+	socket, err := agentSocket()
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.DialTimeout("unix", socket, agentTimeout)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errAgentNotRunning, err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	if _, err := fmt.Fprintln(conn, req); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("password agent: %w", err)
+	}
+
+	status, data, _ := strings.Cut(strings.TrimSpace(reply), " ")
+	if status != "ok" {
+		return "", fmt.Errorf("password agent: %s", data)
+	}
+
+	return data, nil
+}
+
+// ServeAgent runs the password agent until all its keys expired or it is
+// stopped. It returns right away when an agent is already running.
+func ServeAgent() error {
+	if _, err := agentRequest("ping"); err == nil {
+		return nil
+	}
+
+	socket, err := agentSocket()
+	if err != nil {
+		return err
+	}
+
+	// The socket of an agent that did not exit cleanly.
+	_ = os.Remove(socket)
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	agent := &agentServer{
+		secrets: make(map[string]agentSecret),
+		started: time.Now(),
+	}
+	defer agent.forget()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if agent.expire() {
+				l.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			if agent.serve(conn) {
+				l.Close()
+			}
+		}()
+	}
+}
+
+type agentSecret struct {
+	secret  []byte
+	expires time.Time
+}
+
+type agentServer struct {
+	mu      sync.Mutex
+	secrets map[string]agentSecret
+	started time.Time
+	stopped bool
+}
+
+// serve answers a request. It reports whether the agent has to stop.
+func (a *agentServer) serve(conn net.Conn) bool {
+	_ = conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	req, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	reply, stop := a.handle(strings.Fields(req))
+	fmt.Fprintln(conn, reply)
+
+	return stop
+}
+
+func (a *agentServer) handle(req []string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.stopped:
+		return "error stopping", false
+	case len(req) == 1 && req[0] == "ping":
+		return "ok", false
+	case len(req) == 2 && req[0] == "get":
+		s, ok := a.secrets[req[1]]
+		if !ok || time.Now().After(s.expires) {
+			return "ok", false
+		}
+
+		return "ok " + base64.StdEncoding.EncodeToString(s.secret), false
+	case len(req) == 4 && req[0] == "put":
+		seconds, err := strconv.ParseInt(req[2], 10, 64)
+		if err != nil || seconds <= 0 {
+			return "error invalid ttl", false
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(req[3])
+		if err != nil {
+			return "error invalid secret", false
+		}
+
+		a.secrets[req[1]] = agentSecret{
+			secret:  secret,
+			expires: time.Now().Add(time.Duration(seconds) * time.Second),
+		}
+
+		return "ok", false
+	case len(req) == 1 && req[0] == "lock":
+		a.stopped = true
+		return "ok", true
+	default:
+		return "error invalid request", false
+	}
+}
+
+// expire forgets the expired keys. It reports whether the agent has to stop
+// because it holds no keys anymore.
+func (a *agentServer) expire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range a.secrets {
+		if now.After(s.expires) {
+			clear(s.secret)
+			delete(a.secrets, id)
+		}
+	}
+
+	return len(a.secrets) == 0 && now.Sub(a.started) > agentIdle
+}
+
+// forget clears all keys from memory.
+func (a *agentServer) forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, s := range a.secrets {
+		clear(s.secret)
+		delete(a.secrets, id)
+	}
+	a.stopped = true
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package command
+
+import "errors"
+
+var errAgentUnsupported = errors.New("the password agent is not supported on this platform")
+
+func agentSocket() (string, error) {
+	return "", errAgentUnsupported
+}
+
+func startAgent() error {
+	return errAgentUnsupported
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// agentSocket returns the path of the socket of the password agent. Its
+// directory is created if needed and must only be accessible to the user.
+func agentSocket() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "viking")
+	} else {
+		dir = filepath.Join(os.TempDir(), "viking-"+strconv.Itoa(os.Getuid()))
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() || info.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("password agent directory %s must be a directory only accessible to the user", dir)
+	}
+
+	return filepath.Join(dir, "agent.sock"), nil
+}
+
+// startAgent starts the password agent in the background and waits until it
+// accepts requests.
+func startAgent() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, "config", "agent")
+	// Keep the agent running when the terminal is closed.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	deadline := time.Now().Add(agentTimeout)
+	for {
+		_, err := agentRequest("ping")
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
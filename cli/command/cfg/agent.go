@@ -0,0 +1,19 @@
+package cfg
+
+import (
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+// NewAgentCmd runs the password agent, started in the background by viking
+// when the master password is entered.
+func NewAgentCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:   "agent",
+		Usage:  "Run the password agent",
+		Hidden: true,
+		Action: func(ctx *cli.Context) error {
+			return command.ServeAgent()
+		},
+	}
+}
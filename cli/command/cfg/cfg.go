@@ -13,6 +13,13 @@ func NewConfigCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
 		Name:  "config",
 		Usage: "Get config directory path",
+		Subcommands: []*cli.Command{
+			NewEncryptCmd(vikingCli),
+			NewDecryptCmd(vikingCli),
+			NewLockCmd(vikingCli),
+			NewAgentCmd(vikingCli),
+			NewRestoreCmd(vikingCli),
+		},
 		Action: func(ctx *cli.Context) error {
 			path, err := config.ConfigDir()
 			if err != nil {
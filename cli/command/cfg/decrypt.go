@@ -0,0 +1,28 @@
+package cfg
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewDecryptCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "decrypt",
+		Usage: "Store private keys and passphrases in plain text again",
+		Action: func(ctx *cli.Context) error {
+			return runDecrypt(vikingCli)
+		},
+	}
+}
+
+func runDecrypt(vikingCli *command.Cli) error {
+	if err := vikingCli.Config.DecryptKeys(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(vikingCli.Out, "Keys decrypted.")
+
+	return nil
+}
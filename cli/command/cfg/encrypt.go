@@ -0,0 +1,54 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewEncryptCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "encrypt",
+		Usage: "Encrypt private keys and passphrases with a master password",
+		Description: fmt.Sprintf("Encrypts the key material of the existing config in place. The master password is asked for when a key is needed "+
+			"and kept by the password agent for --unlock-ttl, see viking config lock. Scripts can pass it in %s.", command.VIKING_MASTER_PASSWORD),
+		Action: func(ctx *cli.Context) error {
+			return runEncrypt(vikingCli)
+		},
+	}
+}
+
+func runEncrypt(vikingCli *command.Cli) error {
+	if vikingCli.Config.Encrypted() {
+		return errors.New("config is already encrypted")
+	}
+
+	password := os.Getenv(command.VIKING_MASTER_PASSWORD)
+	if password == "" {
+		var err error
+		password, err = command.PromptPassword(vikingCli.In, vikingCli.Err, "New master password")
+		if err != nil {
+			return err
+		}
+
+		confirm, err := command.PromptPassword(vikingCli.In, vikingCli.Err, "Repeat master password")
+		if err != nil {
+			return err
+		}
+
+		if password != confirm {
+			return errors.New("passwords do not match")
+		}
+	}
+
+	if err := vikingCli.Config.EncryptKeys(password); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(vikingCli.Out, "Keys encrypted.")
+
+	return nil
+}
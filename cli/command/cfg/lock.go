@@ -0,0 +1,35 @@
+package cfg
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewLockCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:        "lock",
+		Usage:       "Forget the cached master password",
+		Description: "Stops the password agent, the next command needing a key asks for the master password again.",
+		Action: func(ctx *cli.Context) error {
+			return runLock(vikingCli)
+		},
+	}
+}
+
+func runLock(vikingCli *command.Cli) error {
+	running, err := command.StopAgent()
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		fmt.Fprintln(vikingCli.Out, "No master password cached.")
+		return nil
+	}
+
+	fmt.Fprintln(vikingCli.Out, "Master password forgotten.")
+
+	return nil
+}
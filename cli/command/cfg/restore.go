@@ -0,0 +1,128 @@
+package cfg
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+)
+
+func NewRestoreCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "restore",
+		Usage:     "Restore the config from a backup",
+		Args:      true,
+		ArgsUsage: "[BACKUP]",
+		Description: "The config of a profile is backed up every time it changes, the last 20 backups are kept in the " +
+			"backups folder of the config directory. Without BACKUP the latest backup is restored. The replaced config " +
+			"is backed up too, so a restore can be undone by restoring again.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "list",
+				Aliases: []string{"l"},
+				Usage:   "List the backups instead of restoring one",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Usage:   command.FormatUsage + ", with --list",
+				Value:   "table",
+				Aliases: []string{"f"},
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Do not ask for confirmation",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() > 1 {
+				return fmt.Errorf("expected at most 1 argument, got %d", ctx.NArg())
+			}
+
+			if ctx.Bool("list") {
+				return listBackups(vikingCli, ctx.String("format"))
+			}
+
+			return runRestore(vikingCli, ctx.Args().First(), ctx.Bool("force"))
+		},
+	}
+}
+
+type backupView struct {
+	Name      string    `json:"name" yaml:"name"`
+	Machines  int       `json:"machines" yaml:"machines"`
+	Keys      int       `json:"keys" yaml:"keys"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
+
+func listBackups(vikingCli *command.Cli, format string) error {
+	backups, err := config.ListBackups(vikingCli.Config.ProfileName())
+	if err != nil {
+		return err
+	}
+
+	listing := command.Listing{
+		Items: make([]backupView, len(backups)),
+		Header: []string{
+			"NAME",
+			"MACHINES",
+			"KEYS",
+			"CREATED",
+		},
+		CSVRows: [][]string{},
+	}
+
+	for i, backup := range backups {
+		cfg, err := config.ParseBackup(backup)
+		if err != nil {
+			return err
+		}
+
+		view := backupView{
+			Name:      backup.Name,
+			Machines:  len(cfg.Machines),
+			Keys:      len(cfg.Keys),
+			CreatedAt: backup.CreatedAt,
+		}
+		listing.Items.([]backupView)[i] = view
+
+		row := []string{view.Name, strconv.Itoa(view.Machines), strconv.Itoa(view.Keys)}
+		listing.Rows = append(listing.Rows, append(row, humanize.Time(view.CreatedAt)))
+		listing.CSVRows = append(listing.CSVRows, append(row[:3:3], view.CreatedAt.Format(time.RFC3339)))
+	}
+
+	return command.PrintListing(vikingCli.Out, format, listing)
+}
+
+func runRestore(vikingCli *command.Cli, name string, force bool) error {
+	profile := vikingCli.Config.ProfileName()
+
+	if !force {
+		target := "the latest backup"
+		if name != "" {
+			target = "backup " + name
+		}
+
+		ok, err := command.PromptForConfirmation(vikingCli.In, vikingCli.Out,
+			fmt.Sprintf("Replace the config of profile %s with %s?", profile, target))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+	}
+
+	backup, err := config.RestoreBackup(profile, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Config of profile %s restored from %s.\n", profile, backup.Name)
+
+	return nil
+}
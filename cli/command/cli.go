@@ -1,11 +1,17 @@
 package command
 
 import (
+	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/d3witt/viking/config"
 	"github.com/d3witt/viking/sshexec"
 	"github.com/d3witt/viking/streams"
+	"golang.org/x/crypto/ssh"
 )
 
 type Cli struct {
@@ -13,38 +19,230 @@ type Cli struct {
 	Out, Err  *streams.Out
 	In        *streams.In
 	CmdLogger *slog.Logger
+
+	// StrictHostKeys refuses to connect to hosts with unknown host keys
+	// instead of asking the user to trust them.
+	StrictHostKeys bool
+	// SSHKnownHosts additionally trusts keys from ~/.ssh/known_hosts.
+	SSHKnownHosts bool
+
+	hostKeysOnce sync.Once
+	hostKeys     *sshexec.HostKeyStore
+	hostKeysErr  error
+}
+
+// Target is the executor of a selected host.
+type Target struct {
+	sshexec.Executor
+
+	Machine string
+	Host    config.Host
+	// Index is the index of the host in the hosts of the machine in the
+	// config, see config.Machine.HostIndex. Hosts with ResolveAll set give
+	// several targets with the same index.
+	Index int
 }
 
-func (c *Cli) MachineExecuters(machine string) ([]sshexec.Executor, error) {
-	m, err := c.Config.GetMachineByName(machine)
+// MachineTargets returns targets for all hosts matching selector, see
+// config.Selector.
+func (c *Cli) MachineTargets(selector string) ([]Target, error) {
+	machines, err := c.Config.SelectMachines(selector)
 	if err != nil {
 		return nil, err
 	}
 
-	execs := make([]sshexec.Executor, len(m.Hosts))
-	for i, host := range m.Hosts {
-		exec, err := c.HostExecutor(host)
+	// Selected hosts share the connections to their jump hosts.
+	jumps := newJumpHosts(c)
+
+	var targets []Target
+	for _, m := range machines {
+		for i, host := range m.EffectiveHosts() {
+			hosts, err := ResolveHosts([]config.Host{host})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, host := range hosts {
+				cfg, err := c.hostClientConfig(host, jumps)
+				if err != nil {
+					return nil, err
+				}
+
+				targets = append(targets, Target{
+					Executor: jumps.executor(cfg),
+					Machine:  m.Name,
+					Host:     host,
+					Index:    m.HostIndex(i),
+				})
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// ResolveHosts replaces the hosts with ResolveAll set by one host per address
+// their hostname resolves to.
+func ResolveHosts(hosts []config.Host) ([]config.Host, error) {
+	var resolved []config.Host
+	for _, host := range hosts {
+		if !host.ResolveAll {
+			resolved = append(resolved, host)
+			continue
+		}
+
+		ips, err := net.LookupIP(host.Address)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to resolve %s: %w", host.Address, err)
 		}
 
-		execs[i] = exec
+		for _, ip := range ips {
+			host := host
+			host.Address = ip.String()
+			host.ResolveAll = false
+			resolved = append(resolved, host)
+		}
 	}
 
-	return execs, nil
+	return resolved, nil
 }
 
 func (c *Cli) HostExecutor(host config.Host) (sshexec.Executor, error) {
-	var private, passphrase string
-	if host.Key != "" {
-		key, err := c.Config.GetKeyByName(host.Key)
+	jumps := newJumpHosts(c)
+
+	cfg, err := c.hostClientConfig(host, jumps)
+	if err != nil {
+		return nil, err
+	}
+
+	return jumps.executor(cfg), nil
+}
+
+// HostExecutors returns executors for hosts, sharing the connections to
+// their jump hosts like the executors of MachineTargets do.
+func (c *Cli) HostExecutors(hosts []config.Host) ([]sshexec.Executor, error) {
+	jumps := newJumpHosts(c)
+
+	execs := make([]sshexec.Executor, 0, len(hosts))
+	for _, host := range hosts {
+		cfg, err := c.hostClientConfig(host, jumps)
 		if err != nil {
+			for _, exec := range execs {
+				exec.Close()
+			}
+
 			return nil, err
 		}
 
-		private = key.Private
-		passphrase = key.Passphrase
+		execs = append(execs, jumps.executor(cfg))
+	}
+
+	return execs, nil
+}
+
+// HostClientConfig returns the configuration used to connect to host,
+// including its jump hosts. Machine defaults must already be applied to host,
+// see config.Machine.EffectiveHosts. The caller closes the jump hosts with
+// cfg.Jump.Close once done.
+func (c *Cli) HostClientConfig(host config.Host) (sshexec.ClientConfig, error) {
+	return c.hostClientConfig(host, newJumpHosts(c))
+}
+
+func (c *Cli) hostClientConfig(host config.Host, jumps *jumpHosts) (sshexec.ClientConfig, error) {
+	cfg, err := c.clientConfig(host.Address, host.Port, host.User, host.Key)
+	if err != nil {
+		return cfg, err
 	}
 
-	return sshexec.NewExecutor(host.IP.String(), host.Port, host.User, private, passphrase), nil
+	cfg.Jump, err = jumps.resolve(config.SplitJump(host.Jump), host.EffectiveJumpKey(), 0)
+
+	return cfg, err
+}
+
+func (c *Cli) clientConfig(addr string, port int, user, keyName string) (sshexec.ClientConfig, error) {
+	cfg := sshexec.ClientConfig{
+		Host: addr,
+		Port: port,
+		User: user,
+	}
+
+	if keyName != "" {
+		key, err := c.Config.GetKeyByName(keyName)
+		if err != nil {
+			return cfg, err
+		}
+
+		key, err = c.Config.DecryptKey(key)
+		if err != nil {
+			return cfg, err
+		}
+
+		cfg.Private = key.Private
+		cfg.Passphrase = key.Passphrase
+	}
+
+	hostKeys, err := c.HostKeys()
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.HostKeyCallback = hostKeys.Callback()
+	cfg.HostKeyAlgorithms = hostKeys.Algorithms(cfg.Addr())
+
+	return cfg, nil
+}
+
+// VIKING_MASTER_PASSWORD is the environment variable used to pass the
+// master password to non-interactive sessions.
+const VIKING_MASTER_PASSWORD = "VIKING_MASTER_PASSWORD"
+
+// MasterPassword returns the password used to decrypt keys, taken from the
+// environment or asked for on Err. It is only called when the password agent
+// does not know it, see NewPasswordAgent.
+func (c *Cli) MasterPassword() (string, error) {
+	if password := os.Getenv(VIKING_MASTER_PASSWORD); password != "" {
+		return password, nil
+	}
+
+	password, err := PromptPassword(c.In, c.Err, "Master password")
+	if err != nil {
+		return "", fmt.Errorf("%w, set %s", err, VIKING_MASTER_PASSWORD)
+	}
+
+	return password, nil
+}
+
+// HostKeys returns the store used to verify host keys.
+func (c *Cli) HostKeys() (*sshexec.HostKeyStore, error) {
+	c.hostKeysOnce.Do(func() {
+		file, err := config.KnownHostsFile()
+		if err != nil {
+			c.hostKeysErr = err
+			return
+		}
+
+		var extra []string
+		if c.SSHKnownHosts {
+			if home, err := os.UserHomeDir(); err == nil {
+				extra = append(extra, filepath.Join(home, ".ssh", "known_hosts"))
+			}
+		}
+
+		c.hostKeys = sshexec.NewHostKeyStore(file, extra...)
+		c.hostKeys.Strict = c.StrictHostKeys
+		c.hostKeys.Prompt = c.promptHostKey
+	})
+
+	return c.hostKeys, c.hostKeysErr
+}
+
+func (c *Cli) promptHostKey(host string, key ssh.PublicKey) (bool, error) {
+	if !c.In.IsTerminal() {
+		return false, nil
+	}
+
+	fmt.Fprintf(c.Err, "The authenticity of host '%s' can't be established.\n", host)
+	fmt.Fprintf(c.Err, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+
+	return PromptForConfirmation(c.In, c.Err, "Are you sure you want to continue connecting?")
 }
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/d3witt/viking/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatUsage describes the values accepted by format flags.
+const FormatUsage = "Output format: table, json, yaml, csv or a Go template, e.g. '{{.Name}}'"
+
+// Listing is the data printed by list commands.
+type Listing struct {
+	// Items is a slice printed by the json, yaml and template formats. The
+	// template is executed for every item.
+	Items any
+	// Header and Rows are printed by the table and csv formats.
+	Header []string
+	Rows   [][]string
+	// CSVRows are printed instead of Rows by the csv format, when set. Use
+	// it when table rows leave cells empty for readability.
+	CSVRows [][]string
+	// CSVHeader is printed instead of Header by the csv format, when set,
+	// for CSVRows with other columns than the table.
+	CSVHeader []string
+	// Footer is printed below the table by the table format, when set. The
+	// other formats are read by scripts and never include it.
+	Footer string
+}
+
+// ProfileFooter returns the footer of listings showing the content of the
+// profile of cfg.
+func ProfileFooter(cfg *config.Config) string {
+	return "Profile: " + cfg.ProfileName()
+}
+
+// PrintListing prints the listing in the given format.
+func PrintListing(out io.Writer, format string, l Listing) error {
+	switch format {
+	case "", "table":
+		if err := PrintTable(out, append([][]string{l.Header}, l.Rows...)); err != nil {
+			return err
+		}
+		if l.Footer != "" {
+			fmt.Fprintf(out, "\n%s\n", l.Footer)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l.Items)
+	case "yaml":
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(l.Items); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "csv":
+		header, rows := l.Header, l.Rows
+		if l.CSVHeader != nil {
+			header = l.CSVHeader
+		}
+		if l.CSVRows != nil {
+			rows = l.CSVRows
+		}
+
+		w := csv.NewWriter(out)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		if err := w.WriteAll(rows); err != nil {
+			return err
+		}
+		return w.Error()
+	}
+
+	if !strings.Contains(format, "{{") {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	tmpl, err := template.New("format").Parse(format)
+	if err != nil {
+		return fmt.Errorf("invalid format template: %w", err)
+	}
+
+	items := reflect.ValueOf(l.Items)
+	for i := 0; i < items.Len(); i++ {
+		if err := tmpl.Execute(out, items.Index(i).Interface()); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package hostkey
+
+import (
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "hostkey",
+		Usage: "Manage known host keys",
+		Subcommands: []*cli.Command{
+			NewListCmd(vikingCli),
+			NewScanCmd(vikingCli),
+			NewRmCmd(vikingCli),
+		},
+	}
+}
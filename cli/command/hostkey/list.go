@@ -0,0 +1,56 @@
+package hostkey
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+func NewListCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "ls",
+		Usage: "List pinned host keys",
+		Action: func(ctx *cli.Context) error {
+			return listHostKeys(vikingCli)
+		},
+	}
+}
+
+func listHostKeys(vikingCli *command.Cli) error {
+	store, err := vikingCli.HostKeys()
+	if err != nil {
+		return err
+	}
+
+	hosts, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hosts[i].Hosts[0] < hosts[j].Hosts[0]
+	})
+
+	data := [][]string{
+		{
+			"HOST",
+			"TYPE",
+			"FINGERPRINT",
+		},
+	}
+
+	for _, host := range hosts {
+		data = append(data, []string{
+			strings.Join(host.Hosts, ","),
+			host.Key.Type(),
+			ssh.FingerprintSHA256(host.Key),
+		})
+	}
+
+	command.PrintTable(vikingCli.Out, data)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package hostkey
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewRmCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "rm",
+		Usage:     "Forget the host keys of a machine or host",
+		Args:      true,
+		ArgsUsage: "MACHINE | HOST[:PORT]",
+		Action: func(ctx *cli.Context) error {
+			target := ctx.Args().First()
+			return runRemove(vikingCli, target)
+		},
+	}
+}
+
+func runRemove(vikingCli *command.Cli, target string) error {
+	if target == "" {
+		return fmt.Errorf("machine or host is required")
+	}
+
+	store, err := vikingCli.HostKeys()
+	if err != nil {
+		return err
+	}
+
+	addrs := []string{target}
+	if m, err := vikingCli.Config.GetMachineByName(target); err == nil {
+		hosts, err := command.ResolveHosts(m.EffectiveHosts())
+		if err != nil {
+			return err
+		}
+
+		addrs = addrs[:0]
+		for _, host := range hosts {
+			addrs = append(addrs, command.HostAddr(host))
+		}
+	}
+
+	removed := 0
+	for _, addr := range addrs {
+		n, err := store.Forget(addr)
+		if err != nil {
+			return err
+		}
+
+		removed += n
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Removed %d host key(s).\n", removed)
+
+	return nil
+}
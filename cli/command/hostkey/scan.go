@@ -0,0 +1,117 @@
+package hostkey
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshexec"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+func NewScanCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:        "scan",
+		Usage:       "Fetch and pin the host keys of a machine",
+		Description: "Connects to every host of the machine, without logging in, and pins the host key it presents. Keys that changed since they were pinned are replaced after confirmation.",
+		Args:        true,
+		ArgsUsage:   "MACHINE",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Replace changed keys without confirmation",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			machine := ctx.Args().First()
+			yes := ctx.Bool("yes")
+
+			return runScan(vikingCli, machine, yes)
+		},
+	}
+}
+
+func runScan(vikingCli *command.Cli, machine string, yes bool) error {
+	m, err := vikingCli.Config.GetMachineByName(machine)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := command.ResolveHosts(m.EffectiveHosts())
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if err := Pin(vikingCli, host, yes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Pin fetches the key presented by host and pins it. When a different key
+// is already pinned, the user is asked to confirm the change unless yes is
+// set.
+func Pin(vikingCli *command.Cli, host config.Host, yes bool) error {
+	store, err := vikingCli.HostKeys()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := vikingCli.HostClientConfig(host)
+	if err != nil {
+		return err
+	}
+	defer cfg.Jump.Close()
+
+	key, err := sshexec.ScanHostKey(cfg)
+	if err != nil && len(cfg.HostKeyAlgorithms) > 0 {
+		// The host may no longer offer the key type we know about.
+		cfg.HostKeyAlgorithms = nil
+		key, err = sshexec.ScanHostKey(cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	addr := cfg.Addr()
+
+	known, err := store.Lookup(addr)
+	if err != nil {
+		return err
+	}
+
+	if len(known) == 1 && bytes.Equal(known[0].Marshal(), key.Marshal()) {
+		fmt.Fprintf(vikingCli.Out, "%s: %s key %s already pinned.\n", cfg.Host, key.Type(), ssh.FingerprintSHA256(key))
+		return nil
+	}
+
+	if len(known) > 0 && !yes {
+		fmt.Fprintf(vikingCli.Out, "The host key for %s has changed.\n", cfg.Host)
+		for _, k := range known {
+			fmt.Fprintf(vikingCli.Out, "Pinned:    %s %s\n", k.Type(), ssh.FingerprintSHA256(k))
+		}
+		fmt.Fprintf(vikingCli.Out, "Presented: %s %s\n", key.Type(), ssh.FingerprintSHA256(key))
+
+		ok, err := command.PromptForConfirmation(vikingCli.In, vikingCli.Out, "Replace the pinned key?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("host key for %s was not replaced", cfg.Host)
+		}
+	}
+
+	if err := store.Pin(addr, key); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "%s: pinned %s key %s.\n", cfg.Host, key.Type(), ssh.FingerprintSHA256(key))
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshexec"
+)
+
+// MaxJumpDepth limits the length of jump host chains, mostly to detect
+// machines that jump through each other.
+const MaxJumpDepth = 10
+
+// ParseHostSpec parses a [USER@]HOST[:PORT] spec. IPv6 addresses with a port
+// must be enclosed in brackets.
+func ParseHostSpec(val, defaultUser string, defaultPort int) (user, host string, port int, err error) {
+	user = defaultUser
+	port = defaultPort
+
+	if idx := strings.LastIndex(val, "@"); idx != -1 {
+		user = val[:idx]
+		val = val[idx+1:]
+	}
+
+	host, portStr, splitErr := net.SplitHostPort(val)
+	if splitErr != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(val, "["), "]")
+	} else {
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			err = errors.New("invalid port number")
+			return
+		}
+	}
+
+	if host == "" {
+		err = errors.New("host is required")
+	}
+
+	return
+}
+
+// HostAddr returns the address of host, with the port if it is not the
+// default one.
+func HostAddr(host config.Host) string {
+	if host.Port == 22 {
+		return host.Address
+	}
+
+	return net.JoinHostPort(host.Address, strconv.Itoa(host.Port))
+}
+
+// LocalUser returns the name of the user running viking, the user ssh logs
+// in as when none is given.
+func LocalUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return "root"
+	}
+
+	// Windows user names include the domain.
+	name := u.Username
+	if idx := strings.LastIndex(name, `\`); idx != -1 {
+		name = name[idx+1:]
+	}
+
+	return name
+}
+
+// jumpHosts resolves jump host chains. Hosts using the same chain share a
+// single connection to the jump hosts, which stays open until the last of
+// the executors returned by executor is closed.
+type jumpHosts struct {
+	cli   *Cli
+	cache map[string]*sshexec.JumpHost
+
+	mu   sync.Mutex
+	refs int
+}
+
+func newJumpHosts(cli *Cli) *jumpHosts {
+	return &jumpHosts{
+		cli:   cli,
+		cache: make(map[string]*sshexec.JumpHost),
+	}
+}
+
+// resolve returns the jump host for the given chain. Jump hosts given as a
+// HOST spec are authenticated with key, the jump key of the host whose chain
+// lists them, see config.Host.JumpKey, and log in as the local user unless
+// the spec names one.
+func (j *jumpHosts) resolve(chain []string, key string, depth int) (*sshexec.JumpHost, error) {
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	if depth >= MaxJumpDepth {
+		return nil, fmt.Errorf("jump host chain is longer than %d hosts, check for loops", MaxJumpDepth)
+	}
+
+	cacheKey := strings.Join(chain, ",") + "|" + key
+	if jump, ok := j.cache[cacheKey]; ok {
+		return jump, nil
+	}
+
+	last := chain[len(chain)-1]
+	parentChain := chain[:len(chain)-1]
+
+	var cfg sshexec.ClientConfig
+	var err error
+
+	parentKey := key
+	if m, mErr := j.cli.Config.GetMachineByName(last); mErr == nil {
+		if len(m.Hosts) == 0 {
+			return nil, fmt.Errorf("jump machine %s has no hosts", m.Name)
+		}
+
+		host := m.EffectiveHosts()[0]
+		if len(parentChain) == 0 {
+			parentChain = config.SplitJump(host.Jump)
+			parentKey = host.EffectiveJumpKey()
+		}
+
+		cfg, err = j.cli.clientConfig(host.Address, host.Port, host.User, host.Key)
+	} else {
+		user, addr, port, parseErr := ParseHostSpec(last, LocalUser(), 22)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid jump host %q: %w", last, parseErr)
+		}
+
+		cfg, err = j.cli.clientConfig(addr, port, user, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Jump, err = j.resolve(parentChain, parentKey, depth+1)
+	if err != nil {
+		return nil, err
+	}
+
+	jump := sshexec.NewJumpHost(cfg)
+	j.cache[cacheKey] = jump
+
+	return jump, nil
+}
+
+// executor returns an executor for cfg. The jump hosts are closed once all
+// the executors using them are closed.
+func (j *jumpHosts) executor(cfg sshexec.ClientConfig) sshexec.Executor {
+	exec := sshexec.NewExecutor(cfg)
+	if cfg.Jump == nil {
+		return exec
+	}
+
+	j.mu.Lock()
+	j.refs++
+	j.mu.Unlock()
+
+	return &jumpExecutor{
+		Executor: exec,
+		jumps:    j,
+	}
+}
+
+// release closes the jump hosts when the last executor using them is
+// closed.
+func (j *jumpHosts) release() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.refs--
+	if j.refs > 0 {
+		return
+	}
+
+	for _, jump := range j.cache {
+		_ = jump.Close()
+	}
+}
+
+// jumpExecutor is an executor connected through shared jump hosts.
+type jumpExecutor struct {
+	sshexec.Executor
+
+	jumps *jumpHosts
+	once  sync.Once
+}
+
+func (e *jumpExecutor) Close() error {
+	err := e.Executor.Close()
+	e.once.Do(e.jumps.release)
+
+	return err
+}
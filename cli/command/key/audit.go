@@ -0,0 +1,257 @@
+package key
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// readScript prints the authorized_keys file, nothing if it does not exist.
+const readScript = authorizedKeysScript + `
+if [ -e "$file" ]; then
+	$run cat "$file"
+fi
+`
+
+const (
+	auditViking    = "viking"
+	auditUnknown   = "unknown"
+	auditDuplicate = "duplicate"
+	auditInvalid   = "invalid"
+)
+
+func NewAuditCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "audit",
+		Usage:     "Check the authorized keys of machines",
+		Args:      true,
+		ArgsUsage: "MACHINE|SELECTOR",
+		Description: "Fetches ~/.ssh/authorized_keys of every selected host and classifies its entries:\n\n" +
+			"  viking     a key of the config, named in the KEY column\n" +
+			"  unknown    a key viking does not know\n" +
+			"  duplicate  a key already authorized on an earlier line\n" +
+			"  invalid    a line that is not a valid entry\n\n" +
+			"Comments and empty lines are skipped.\n\n" +
+			"Examples:\n" +
+			"  viking key audit deathstar\n" +
+			"  viking key audit -f '{{if eq .Status \"unknown\"}}{{.Machine}} {{.Fingerprint}}{{end}}' role=web",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "user",
+				Aliases: []string{"u"},
+				Usage:   "Remote user to audit, the connecting user by default",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   command.FormatUsage,
+			},
+		}, command.RunFlags()...),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			run, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			return runAudit(ctx.Context, vikingCli, ctx.Args().First(), ctx.String("user"), ctx.String("format"), run)
+		},
+	}
+}
+
+// auditEntry is an entry of a remote authorized_keys file.
+type auditEntry struct {
+	Machine     string   `json:"machine" yaml:"machine"`
+	Address     string   `json:"address" yaml:"address"`
+	Port        int      `json:"port" yaml:"port"`
+	Line        int      `json:"line" yaml:"line"`
+	Status      string   `json:"status" yaml:"status"`
+	Key         string   `json:"key,omitempty" yaml:"key,omitempty"`
+	DuplicateOf int      `json:"duplicate_of,omitempty" yaml:"duplicate_of,omitempty"`
+	Type        string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Fingerprint string   `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Comment     string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Options     []string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+func runAudit(ctx context.Context, vikingCli *command.Cli, selector, user, format string, opts command.RunOptions) error {
+	if user != "" && !validRemoteUser(user) {
+		return fmt.Errorf("invalid user %q", user)
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	targets, err := vikingCli.MachineTargets(selector)
+	defer func() {
+		for _, target := range targets {
+			target.Close()
+		}
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	known := knownKeys(vikingCli)
+	entries := make([][]auditEntry, len(targets))
+
+	errs := vikingCli.RunTargets(ctx, targets, opts, func(ctx context.Context, i int, target command.Target) error {
+		out, err := runScript(ctx, target, readScript, user)
+		if err != nil {
+			return err
+		}
+
+		if entries[i], err = auditAuthorizedKeys(out, known); err != nil {
+			return err
+		}
+
+		for j := range entries[i] {
+			entries[i][j].Machine = target.Machine
+			entries[i][j].Address = target.Host.Address
+			entries[i][j].Port = target.Host.Port
+		}
+
+		return nil
+	})
+
+	listing := command.Listing{
+		Items: []auditEntry{},
+		Header: []string{
+			"HOST",
+			"LINE",
+			"STATUS",
+			"KEY",
+			"TYPE",
+			"FINGERPRINT",
+			"COMMENT",
+		},
+	}
+
+	failed := 0
+	for i, target := range targets {
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(vikingCli.Err, "%s: error: %v\n", targetLabel(target), errs[i])
+			continue
+		}
+
+		for _, entry := range entries[i] {
+			status := entry.Status
+			if entry.DuplicateOf != 0 {
+				status += " of " + strconv.Itoa(entry.DuplicateOf)
+			}
+
+			listing.Items = append(listing.Items.([]auditEntry), entry)
+			listing.Rows = append(listing.Rows, []string{
+				targetLabel(target),
+				strconv.Itoa(entry.Line),
+				status,
+				entry.Key,
+				entry.Type,
+				entry.Fingerprint,
+				entry.Comment,
+			})
+		}
+	}
+
+	if err := command.PrintListing(vikingCli.Out, format, listing); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("audit failed on %d of %d hosts", failed, len(targets)), 1)
+	}
+
+	return nil
+}
+
+// knownKeys maps the marshaled public keys of the config to the key names.
+func knownKeys(vikingCli *command.Cli) map[string]string {
+	keys := vikingCli.Config.ListKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+
+	known := make(map[string]string, len(keys))
+	for _, key := range keys {
+		pub, _, err := publicKey(key)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := known[string(pub.Marshal())]; !ok {
+			known[string(pub.Marshal())] = key.Name
+		}
+	}
+
+	return known
+}
+
+// auditAuthorizedKeys classifies the entries of an authorized_keys file, see
+// NewAuditCmd. It fails when the file cannot be read to the end, such as on
+// lines longer than 1 MiB.
+func auditAuthorizedKeys(data string, known map[string]string) ([]auditEntry, error) {
+	var entries []auditEntry
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		entry := auditEntry{Line: n}
+
+		pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			entry.Status = auditInvalid
+			entries = append(entries, entry)
+			continue
+		}
+
+		blob := string(pub.Marshal())
+
+		entry.Type = pub.Type()
+		entry.Fingerprint = ssh.FingerprintSHA256(pub)
+		entry.Comment = comment
+		entry.Options = options
+		entry.Key = known[blob]
+
+		switch {
+		case seen[blob] != 0:
+			entry.Status = auditDuplicate
+			entry.DuplicateOf = seen[blob]
+		case entry.Key != "":
+			entry.Status = auditViking
+		default:
+			entry.Status = auditUnknown
+		}
+
+		if seen[blob] == 0 {
+			seen[blob] = n
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+
+	return entries, nil
+}
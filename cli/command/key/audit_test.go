@@ -0,0 +1,114 @@
+package key
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testPublicKey returns a public key derived from seed.
+func testPublicKey(t *testing.T, seed byte) ssh.PublicKey {
+	t.Helper()
+
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+
+	pub, err := ssh.NewPublicKey(priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pub
+}
+
+func TestAuditAuthorizedKeys(t *testing.T) {
+	deploy := testPublicKey(t, 1)
+	other := testPublicKey(t, 2)
+
+	deployLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(deploy)))
+	otherLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other)))
+
+	known := map[string]string{string(deploy.Marshal()): "deploy"}
+
+	viking := func(line int, comment string, options ...string) auditEntry {
+		return auditEntry{
+			Line:        line,
+			Status:      auditViking,
+			Key:         "deploy",
+			Type:        ssh.KeyAlgoED25519,
+			Fingerprint: ssh.FingerprintSHA256(deploy),
+			Comment:     comment,
+			Options:     options,
+		}
+	}
+
+	unknown := auditEntry{
+		Line:        1,
+		Status:      auditUnknown,
+		Type:        ssh.KeyAlgoED25519,
+		Fingerprint: ssh.FingerprintSHA256(other),
+		Comment:     "someone",
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want []auditEntry
+	}{
+		{"empty", "", nil},
+		{"comments", "# comment\n\n   \n", nil},
+		{"viking", deployLine + " viking\n", []auditEntry{viking(1, "viking")}},
+		{
+			name: "options",
+			data: `from="10.0.0.1",no-pty ` + deployLine + " viking",
+			want: []auditEntry{viking(1, "viking", `from="10.0.0.1"`, "no-pty")},
+		},
+		{"unknown", otherLine + " someone\n", []auditEntry{unknown}},
+		{
+			name: "duplicate",
+			data: deployLine + " first\n# comment\n" + deployLine + " second\n",
+			want: []auditEntry{
+				viking(1, "first"),
+				func() auditEntry {
+					e := viking(3, "second")
+					e.Status = auditDuplicate
+					e.DuplicateOf = 1
+					return e
+				}(),
+			},
+		},
+		{
+			name: "invalid",
+			data: "ssh-ed25519 AAAA broken\n" + otherLine + " someone",
+			want: []auditEntry{
+				{Line: 1, Status: auditInvalid},
+				func() auditEntry {
+					e := unknown
+					e.Line = 2
+					return e
+				}(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := auditAuthorizedKeys(tt.data, known)
+		if err != nil {
+			t.Errorf("%s: auditAuthorizedKeys: %v", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: auditAuthorizedKeys = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Lines longer than the scanner buffer fail the host.
+	long := deployLine + " " + strings.Repeat("x", 1024*1024) + "\n"
+	if _, err := auditAuthorizedKeys(long, known); err == nil {
+		t.Error("auditAuthorizedKeys of a line longer than 1 MiB succeeded")
+	}
+}
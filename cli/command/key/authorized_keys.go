@@ -0,0 +1,219 @@
+package key
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshexec"
+	"golang.org/x/crypto/ssh"
+)
+
+// authorizedKeysScript is the start of the scripts changing the
+// authorized_keys file of a remote user. It takes the user as $1, the
+// connecting user if empty, and sets home, dir and file. When the user is
+// not the connecting one, commands touching the file are prefixed with $run,
+// which uses sudo unless connected as root. lock serializes changes to the
+// file, which may be shared by several hosts, e.g. on NFS.
+const authorizedKeysScript = `set -e
+user=$1
+run=
+other=
+if [ -z "$user" ] || [ "$user" = "$(id -un)" ]; then
+	user=$(id -un)
+	home=$HOME
+else
+	other=1
+	[ "$(id -u)" = 0 ] || run="sudo -n"
+	home=$(getent passwd "$user" 2>/dev/null | cut -d: -f6)
+	[ -n "$home" ] || home=$(eval echo "~$user")
+	case $home in "~"*|"") echo "unknown user $user" >&2; exit 1;; esac
+fi
+dir=$home/.ssh
+file=$dir/authorized_keys
+tmp=
+lock() {
+	n=0
+	until $run mkdir "$dir/.viking.lock" 2> /dev/null; do
+		n=$((n + 1))
+		if [ "$n" -ge 30 ]; then
+			echo "$dir/.viking.lock is held, remove it if viking is not running" >&2
+			exit 1
+		fi
+		sleep 1
+	done
+	trap '[ -z "$tmp" ] || rm -f "$tmp"; $run rmdir "$dir/.viking.lock"' EXIT
+	trap 'exit 1' HUP INT TERM
+}
+`
+
+// hasKeyScript exits with 0 when the key of type $2 and base64 blob $3 is in
+// the file, skipping comments. Entries may have options before the key.
+const hasKeyScript = `$run awk -v t="$2" -v b="$3" '
+	/^[ \t]*#/ { next }
+	{ for (i = 1; i < NF; i++) if ($i == t && $(i + 1) == b) found = 1 }
+	END { exit !found }
+' "$file"`
+
+// deployScript appends the authorized_keys line $4 to the file unless the key
+// is already there, creating the .ssh directory and the file with the
+// permissions sshd expects. It prints added or present.
+const deployScript = authorizedKeysScript + `
+if [ ! -d "$dir" ]; then
+	$run mkdir -m 700 "$dir"
+	[ -z "$other" ] || $run chown "$user:$(id -gn "$user")" "$dir"
+fi
+lock
+if [ ! -e "$file" ]; then
+	$run touch "$file"
+	$run chmod 600 "$file"
+	[ -z "$other" ] || $run chown "$user:$(id -gn "$user")" "$file"
+fi
+if ` + hasKeyScript + `; then
+	echo present
+	exit 0
+fi
+line=$4
+if [ -s "$file" ] && [ -n "$($run tail -c 1 "$file")" ]; then
+	line="
+$line"
+fi
+printf '%s\n' "$line" | $run tee -a "$file" > /dev/null
+echo added
+`
+
+// revokeScript removes the entries of the key of type $2 and base64 blob $3
+// from the file, keeping its permissions. It prints removed or absent.
+const revokeScript = authorizedKeysScript + `
+if [ ! -e "$file" ]; then
+	echo absent
+	exit 0
+fi
+lock
+if ! ` + hasKeyScript + `; then
+	echo absent
+	exit 0
+fi
+tmp=$(mktemp)
+$run awk -v t="$2" -v b="$3" '
+	/^[ \t]*#/ { print; next }
+	{ for (i = 1; i < NF; i++) if ($i == t && $(i + 1) == b) next }
+	{ print }
+' "$file" > "$tmp"
+$run cp "$tmp" "$file"
+echo removed
+`
+
+// validRemoteUser reports whether user is safe to pass to the scripts, which
+// expand ~user.
+func validRemoteUser(user string) bool {
+	if user == "" || user[0] == '-' {
+		return false
+	}
+
+	for _, r := range user {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// shellQuote quotes s for the remote shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runScript runs script with sh on the remote host and returns its output.
+// The error includes what the script printed to stderr.
+func runScript(ctx context.Context, exec sshexec.Executor, script string, args ...string) (string, error) {
+	quoted := []string{"-c", shellQuote(script), "viking"}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	var stderr bytes.Buffer
+	cmd := sshexec.CommandContext(ctx, exec, "sh", quoted...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *sshexec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && errors.As(err, &exitErr) {
+			return out, errors.New(msg)
+		}
+
+		return out, err
+	}
+
+	return out, nil
+}
+
+// publicKey parses the public key of key.
+func publicKey(key config.Key) (ssh.PublicKey, string, error) {
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(key.Public))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid public key of %s: %w", key.Name, err)
+	}
+
+	return pub, comment, nil
+}
+
+// deployKey adds key to the authorized_keys file of user on the remote host,
+// the connecting user if empty. It reports whether the key was added, false
+// meaning it was already there.
+func deployKey(ctx context.Context, exec sshexec.Executor, key config.Key, user string) (bool, error) {
+	pub, comment, err := publicKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	line := strings.TrimSuffix(authorizedKey(pub, comment), "\n")
+
+	out, err := runScript(ctx, exec, deployScript, user, pub.Type(), keyBlob(pub), line)
+	if err != nil {
+		return false, err
+	}
+
+	return scriptResult(out, "added", "present")
+}
+
+// revokeKey removes key from the authorized_keys file of user on the remote
+// host, the connecting user if empty. It reports whether the key was
+// removed, false meaning it was not there.
+func revokeKey(ctx context.Context, exec sshexec.Executor, key config.Key, user string) (bool, error) {
+	pub, _, err := publicKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := runScript(ctx, exec, revokeScript, user, pub.Type(), keyBlob(pub))
+	if err != nil {
+		return false, err
+	}
+
+	return scriptResult(out, "removed", "absent")
+}
+
+// keyBlob returns the base64 encoded key, as in authorized_keys files.
+func keyBlob(pub ssh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub.Marshal())
+}
+
+// scriptResult converts the output of a script printing done or skipped to
+// a bool.
+func scriptResult(out, done, skipped string) (bool, error) {
+	switch strings.TrimSpace(out) {
+	case done:
+		return true, nil
+	case skipped:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected output %q", out)
+	}
+}
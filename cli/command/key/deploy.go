@@ -0,0 +1,296 @@
+package key
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshexec"
+	"github.com/urfave/cli/v2"
+)
+
+func NewDeployCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "deploy",
+		Usage:     "Authorize a key on machines",
+		Args:      true,
+		ArgsUsage: "KEY MACHINE|SELECTOR",
+		Description: "Connects with the current credentials of every selected host and appends the public key to " +
+			"~/.ssh/authorized_keys, creating the directory and the file with the permissions sshd expects. " +
+			"Keys that are already authorized are left alone, so deploying again is safe.\n\n" +
+			"With --user, the key is authorized for another remote user, which requires connecting as root or " +
+			"a user allowed to run sudo without a password.\n\n" +
+			"With --switch, viking logs in with the key, as --user if given, and makes the hosts where that " +
+			"worked use the key (and the user) from now on. Jump hosts given as specs keep logging in with the " +
+			"previous key, see viking machine edit --jump-key.\n\n" +
+			"Examples:\n" +
+			"  viking key deploy deploy web\n" +
+			"  viking key deploy --switch deploy role=web\n" +
+			"  viking key deploy --user app --switch deploy web",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "user",
+				Aliases: []string{"u"},
+				Usage:   "Remote user to authorize the key for, the connecting user by default",
+			},
+			&cli.BoolFlag{
+				Name:  "switch",
+				Usage: "Use the key for the hosts once a login with it worked",
+			},
+		}, command.RunFlags()...),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 2 {
+				return fmt.Errorf("expected 2 arguments, got %d", ctx.NArg())
+			}
+
+			run, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			opts := deployOptions{
+				User:   ctx.String("user"),
+				Switch: ctx.Bool("switch"),
+				Run:    run,
+			}
+
+			return runDeploy(ctx.Context, vikingCli, ctx.Args().Get(0), ctx.Args().Get(1), opts)
+		},
+	}
+}
+
+type deployOptions struct {
+	User   string
+	Switch bool
+	Run    command.RunOptions
+}
+
+func runDeploy(ctx context.Context, vikingCli *command.Cli, name, selector string, opts deployOptions) error {
+	key, err := vikingCli.Config.GetKeyByName(name)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := publicKey(key); err != nil {
+		return err
+	}
+
+	if opts.User != "" && !validRemoteUser(opts.User) {
+		return fmt.Errorf("invalid user %q", opts.User)
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	targets, err := vikingCli.MachineTargets(selector)
+	defer func() {
+		for _, target := range targets {
+			target.Close()
+		}
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	var verifiers []sshexec.Executor
+	defer func() {
+		for _, exec := range verifiers {
+			exec.Close()
+		}
+	}()
+
+	if opts.Switch {
+		hosts := make([]config.Host, len(targets))
+		for i, target := range targets {
+			hosts[i] = switchedHost(target.Host, name, opts.User)
+		}
+
+		if verifiers, err = vikingCli.HostExecutors(hosts); err != nil {
+			return err
+		}
+	}
+
+	ran := make([]bool, len(targets))
+	deployed := make([]bool, len(targets))
+
+	errs := vikingCli.RunTargets(ctx, targets, opts.Run, func(ctx context.Context, i int, target command.Target) error {
+		ran[i] = true
+		label := targetLabel(target)
+
+		added, err := deployKey(ctx, target, key, opts.User)
+		if err != nil {
+			fmt.Fprintf(vikingCli.Err, "%s: error: %v\n", label, err)
+			return err
+		}
+
+		if added {
+			fmt.Fprintf(vikingCli.Out, "%s: key %s added.\n", label, name)
+		} else {
+			fmt.Fprintf(vikingCli.Out, "%s: key %s already authorized.\n", label, name)
+		}
+		deployed[i] = true
+
+		if opts.Switch {
+			if err := verifyLogin(ctx, verifiers[i]); err != nil {
+				err = fmt.Errorf("login with key %s failed: %w", name, err)
+				fmt.Fprintf(vikingCli.Err, "%s: error: %v\n", label, err)
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	// Errors of hosts that were not run were not printed while running.
+	failed, count := 0, 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			if !ran[i] {
+				fmt.Fprintf(vikingCli.Err, "%s: %v\n", targetLabel(targets[i]), err)
+			}
+		}
+
+		if deployed[i] {
+			count++
+		}
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Key %s deployed to %d of %d hosts.\n", name, count, len(targets))
+
+	if opts.Switch {
+		switched, err := switchHosts(vikingCli, targets, errs, name, opts.User)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(vikingCli.Out, "Switched %d hosts to key %s.\n", switched, name)
+	}
+
+	if failed > 0 {
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+// switchedHost returns host using the key, and user if not empty. The jump
+// hosts given as specs keep the key they logged in with, it is not
+// authorized on them. Machine defaults must be applied to host, see
+// config.Machine.EffectiveHosts.
+func switchedHost(host config.Host, key, user string) config.Host {
+	if host.Jump != "" && host.JumpKey == "" && host.Key != key {
+		host.JumpKey = host.Key
+	}
+
+	host.Key = key
+	if user != "" {
+		host.User = user
+	}
+
+	return host
+}
+
+// verifyLogin checks that a command can be run with exec.
+func verifyLogin(ctx context.Context, exec sshexec.Executor) error {
+	return sshexec.CommandContext(ctx, exec, "true").Run()
+}
+
+// switchHosts makes the hosts of the targets use the key, and user if not
+// empty. Hosts with ResolveAll set are only switched when the key works on
+// all their addresses. It returns the number of hosts switched.
+func switchHosts(vikingCli *command.Cli, targets []command.Target, errs []error, key, user string) (int, error) {
+	refs, groups := groupTargets(targets)
+
+	switched := 0
+	for _, ref := range refs {
+		if !succeeded(errs, groups[ref]) {
+			continue
+		}
+
+		if err := switchHost(vikingCli, ref, key, user); err != nil {
+			return switched, err
+		}
+
+		switched++
+	}
+
+	return switched, nil
+}
+
+// hostRef identifies a host in the config.
+type hostRef struct {
+	machine string
+	index   int
+}
+
+// groupTargets returns the hosts of the targets, in order, and the indexes
+// of the targets of every host. Hosts with ResolveAll set have a target per
+// address.
+func groupTargets(targets []command.Target) ([]hostRef, map[hostRef][]int) {
+	var refs []hostRef
+	groups := make(map[hostRef][]int)
+
+	for i, target := range targets {
+		ref := hostRef{target.Machine, target.Index}
+		if _, ok := groups[ref]; !ok {
+			refs = append(refs, ref)
+		}
+
+		groups[ref] = append(groups[ref], i)
+	}
+
+	return refs, groups
+}
+
+// succeeded reports whether errs is nil at all indexes.
+func succeeded(errs []error, indexes []int) bool {
+	for _, i := range indexes {
+		if errs[i] != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// switchHost makes the host use key, and user if not empty.
+func switchHost(vikingCli *command.Cli, ref hostRef, key, user string) error {
+	m, err := vikingCli.Config.GetMachineByName(ref.machine)
+	if err != nil {
+		return err
+	}
+
+	if ref.index >= len(m.Hosts) {
+		return fmt.Errorf("%w: %s", config.ErrHostNotFound, ref.machine)
+	}
+	want := m.Hosts[ref.index]
+
+	err = vikingCli.Config.UpdateMachine(ref.machine, func(m *config.Machine) error {
+		// The config may have changed since the targets were selected.
+		if ref.index >= len(m.Hosts) || m.Hosts[ref.index].Address != want.Address || m.Hosts[ref.index].Port != want.Port {
+			return fmt.Errorf("%w: %s", config.ErrHostNotFound, command.HostAddr(want))
+		}
+
+		// Only the credentials are taken from the effective host, the
+		// machine defaults stay with the machine.
+		switched := switchedHost(m.EffectiveHosts()[ref.index], key, user)
+
+		host := &m.Hosts[ref.index]
+		host.Key, host.User, host.JumpKey = switched.Key, switched.User, switched.JumpKey
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to switch %s/%s: %w", ref.machine, command.HostAddr(want), err)
+	}
+
+	return nil
+}
+
+// targetLabel names the host of target in the output.
+func targetLabel(target command.Target) string {
+	return target.Machine + "/" + command.HostAddr(target.Host)
+}
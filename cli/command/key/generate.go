@@ -1,11 +1,17 @@
 package key
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/d3witt/viking/cli/command"
@@ -14,41 +20,139 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+const (
+	defaultRSABits   = 3072
+	minRSABits       = 2048
+	maxRSABits       = 16384
+	defaultECDSABits = 256
+)
+
 func NewGenerateCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
 		Name:  "generate",
 		Usage: "Generate a new SSH key",
+		Description: "Keys are ed25519 unless --type is given, and written in the OpenSSH private key format, like " +
+			"ssh-keygen does. The passphrase is never passed on the command line, use --ask-passphrase or " +
+			"--passphrase-file.\n\n" +
+			"Examples:\n" +
+			"  viking key generate --name deploy                      # ed25519\n" +
+			"  viking key generate --name legacy --type rsa --bits 4096\n" +
+			"  viking key generate --name ci --type ecdsa --bits 384 --ask-passphrase",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "name",
 				Usage:   "Key name",
 				Aliases: []string{"n"},
 			},
+			&cli.StringFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Value:   "ed25519",
+				Usage:   "Key type: ed25519, ecdsa or rsa. Earlier versions generated rsa keys, use --type rsa for them",
+			},
+			&cli.IntFlag{
+				Name:        "bits",
+				Aliases:     []string{"b"},
+				Usage:       fmt.Sprintf("Key size, %d to %d for rsa (default %d), 256, 384 or 521 for ecdsa (default %d)", minRSABits, maxRSABits, defaultRSABits, defaultECDSABits),
+				DefaultText: "depends on the type",
+			},
+			&cli.StringFlag{
+				Name:        "comment",
+				Aliases:     []string{"C"},
+				Usage:       "Comment of the public key",
+				DefaultText: "key name",
+			},
+			&cli.BoolFlag{
+				Name:  "ask-passphrase",
+				Usage: "Ask for the passphrase protecting the private key",
+			},
+			&cli.StringFlag{
+				Name:  "passphrase-file",
+				Usage: "Protect the private key with the passphrase on the first line of `FILE`",
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 			name := ctx.String("name")
+			keyType := ctx.String("type")
+			bits := ctx.Int("bits")
+
+			if name == "" {
+				name = command.GenerateRandomName()
+			}
+
+			comment := name
+			if ctx.IsSet("comment") {
+				comment = ctx.String("comment")
+			}
+
+			var passphrase string
+			switch file := ctx.String("passphrase-file"); {
+			case ctx.Bool("ask-passphrase") && file != "":
+				return errors.New("--ask-passphrase and --passphrase-file cannot be used together")
+			case ctx.Bool("ask-passphrase"):
+				var err error
+				if passphrase, err = askPassphrase(vikingCli); err != nil {
+					return err
+				}
+			case file != "":
+				var err error
+				if passphrase, err = readPassphraseFile(file); err != nil {
+					return err
+				}
+			}
 
-			return runGenerate(vikingCli, name)
+			return runGenerate(vikingCli, name, keyType, bits, comment, passphrase)
 		},
 	}
 }
 
-func runGenerate(vikingCli *command.Cli, name string) error {
-	if name == "" {
-		name = command.GenerateRandomName()
+func askPassphrase(vikingCli *command.Cli) (string, error) {
+	passphrase, err := command.PromptPassword(vikingCli.In, vikingCli.Err, "Passphrase")
+	if err != nil {
+		return "", err
+	}
+
+	confirm, err := command.PromptPassword(vikingCli.In, vikingCli.Err, "Repeat passphrase")
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase != confirm {
+		return "", errors.New("passphrases do not match")
 	}
 
-	private, public, err := generateSSHKeyPair()
+	return passphrase, nil
+}
+
+// readPassphraseFile returns the first line of the file at path.
+func readPassphraseFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	passphrase, _, _ := strings.Cut(string(data), "\n")
+	passphrase = strings.TrimSuffix(passphrase, "\r")
+	if passphrase == "" {
+		return "", fmt.Errorf("%s: empty passphrase", path)
+	}
+
+	return passphrase, nil
+}
+
+func runGenerate(vikingCli *command.Cli, name, keyType string, bits int, comment, passphrase string) error {
+	private, public, err := generateSSHKeyPair(keyType, bits, comment, passphrase)
 	if err != nil {
 		return err
 	}
 
 	if err = vikingCli.Config.AddKey(
 		config.Key{
-			Name:      name,
-			Private:   string(private),
-			Public:    string(public),
-			CreatedAt: time.Now(),
+			Name:       name,
+			Private:    private,
+			Public:     public,
+			Passphrase: passphrase,
+			CreatedAt:  time.Now(),
 		},
 	); err != nil {
 		return err
@@ -59,28 +163,98 @@ func runGenerate(vikingCli *command.Cli, name string) error {
 	return nil
 }
 
-func generateSSHKeyPair() (privateKey, publicKey string, err error) {
-	privateRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// generateSSHKeyPair generates a key of the given type and size, bits 0
+// meaning the default size. The private key is returned in the OpenSSH
+// format, the public key in the authorized_keys format.
+func generateSSHKeyPair(keyType string, bits int, comment, passphrase string) (privateKey, publicKey string, err error) {
+	if strings.ContainsAny(comment, "\r\n") {
+		return "", "", errors.New("comment must be a single line")
+	}
+
+	var key crypto.Signer
+
+	switch keyType {
+	case "ed25519":
+		if bits != 0 {
+			return "", "", errors.New("ed25519 keys have a fixed size, --bits cannot be used")
+		}
+
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return "", "", fmt.Errorf("invalid ecdsa key size %d, use 256, 384 or 521", bits)
+		}
+
+		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case "rsa":
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+
+		if bits < minRSABits || bits > maxRSABits {
+			return "", "", fmt.Errorf("invalid rsa key size %d, use %d to %d bits", bits, minRSABits, maxRSABits)
+		}
+
+		key, err = rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return "", "", fmt.Errorf("unknown key type %q, use ed25519, ecdsa or rsa", keyType)
+	}
 	if err != nil {
 		return "", "", err
 	}
 
-	// Generate the private key PEM block.
-	privatePEMBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateRSAKey)}
-
-	// Encode the private key to PEM format.
-	privateKeyBytes := pem.EncodeToMemory(privatePEMBlock)
-	privateKey = string(privateKeyBytes)
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, comment)
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, comment, []byte(passphrase))
+	}
+	if err != nil {
+		return "", "", err
+	}
 
-	// Generate the public key for the private key.
-	publicRSAKey, err := ssh.NewPublicKey(&privateRSAKey.PublicKey)
+	public, err := ssh.NewPublicKey(key.Public())
 	if err != nil {
 		return "", "", err
 	}
 
-	// Encode the public key to the authorized_keys format.
-	publicKeyBytes := ssh.MarshalAuthorizedKey(publicRSAKey)
-	publicKey = string(publicKeyBytes)
+	return string(pem.EncodeToMemory(block)), authorizedKey(public, comment), nil
+}
+
+// keyParams returns the type and size of pub as accepted by
+// generateSSHKeyPair, or an empty type for keys viking cannot generate.
+func keyParams(pub ssh.PublicKey) (keyType string, bits int) {
+	cryptoKey, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return "", 0
+	}
+
+	switch key := cryptoKey.CryptoPublicKey().(type) {
+	case ed25519.PublicKey:
+		return "ed25519", 0
+	case *ecdsa.PublicKey:
+		return "ecdsa", key.Curve.Params().BitSize
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen()
+	default:
+		return "", 0
+	}
+}
+
+// authorizedKey returns the authorized_keys line of key with comment.
+func authorizedKey(key ssh.PublicKey, comment string) string {
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(key)), "\n")
+	if comment != "" {
+		line += " " + comment
+	}
 
-	return privateKey, publicKey, nil
+	return line + "\n"
 }
@@ -15,6 +15,11 @@ func NewCmd(vikingCli *command.Cli) *cli.Command {
 			NewRmCmd(vikingCli),
 			NewGenerateCmd(vikingCli),
 			NewCopyCmd(vikingCli),
+			NewDeployCmd(vikingCli),
+			NewRotateCmd(vikingCli),
+			NewRevokeCmd(vikingCli),
+			NewUsageCmd(vikingCli),
+			NewAuditCmd(vikingCli),
 		},
 	}
 }
@@ -1,45 +1,153 @@
 package key
 
 import (
+	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
 	"github.com/dustin/go-humanize"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
 )
 
 func NewListCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
 		Name:  "ls",
 		Usage: "List all SSH keys",
+		Description: "The table shows the SHA256 fingerprints, or the MD5 ones with --hash md5, like ssh-keygen -E. " +
+			"The other formats include both.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   command.FormatUsage,
+			},
+			&cli.StringFlag{
+				Name:    "hash",
+				Aliases: []string{"E"},
+				Value:   "sha256",
+				Usage:   "Fingerprint hash shown in the table: sha256 or md5",
+			},
+		},
 		Action: func(ctx *cli.Context) error {
-			return listKeys(vikingCli)
+			format := ctx.String("format")
+
+			return listKeys(vikingCli, format, ctx.String("hash"))
 		},
 	}
 }
 
-func listKeys(vikingCli *command.Cli) error {
+// keyView is the listed form of a key. It never includes private material.
+type keyView struct {
+	Name           string    `json:"name" yaml:"name"`
+	Type           string    `json:"type" yaml:"type"`
+	Bits           int       `json:"bits" yaml:"bits"`
+	Public         string    `json:"public" yaml:"public"`
+	Fingerprint    string    `json:"fingerprint" yaml:"fingerprint"`
+	FingerprintMD5 string    `json:"fingerprint_md5" yaml:"fingerprint_md5"`
+	CreatedAt      time.Time `json:"created_at" yaml:"created_at"`
+}
+
+func newKeyView(key config.Key) keyView {
+	view := keyView{
+		Name:      key.Name,
+		Public:    strings.TrimSpace(key.Public),
+		CreatedAt: key.CreatedAt,
+	}
+
+	if pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.Public)); err == nil {
+		view.Type = pub.Type()
+		view.Bits = keyBits(pub)
+		view.Fingerprint = ssh.FingerprintSHA256(pub)
+		view.FingerprintMD5 = fingerprintMD5(pub)
+	}
+
+	return view
+}
+
+// keyBits returns the size of pub in bits, 0 if unknown.
+func keyBits(pub ssh.PublicKey) int {
+	keyType, bits := keyParams(pub)
+	if keyType == "ed25519" {
+		return 256
+	}
+
+	return bits
+}
+
+// fingerprintMD5 returns the MD5 fingerprint of pub in the format of
+// ssh-keygen -E md5.
+func fingerprintMD5(pub ssh.PublicKey) string {
+	return "MD5:" + ssh.FingerprintLegacyMD5(pub)
+}
+
+func listKeys(vikingCli *command.Cli, format, hash string) error {
+	if hash != "sha256" && hash != "md5" {
+		return fmt.Errorf("unknown fingerprint hash %q, use sha256 or md5", hash)
+	}
+
 	keys := vikingCli.Config.ListKeys()
 
 	sort.Slice(keys, func(i, j int) bool {
 		return keys[i].CreatedAt.After(keys[j].CreatedAt)
 	})
 
-	data := [][]string{
-		{
+	listing := command.Listing{
+		Footer: command.ProfileFooter(vikingCli.Config),
+		Items:  make([]keyView, len(keys)),
+		Header: []string{
 			"NAME",
+			"TYPE",
+			"BITS",
+			"FINGERPRINT",
 			"CREATED",
 		},
+		CSVHeader: []string{
+			"NAME",
+			"TYPE",
+			"BITS",
+			"FINGERPRINT",
+			"FINGERPRINT_MD5",
+			"CREATED",
+		},
+		CSVRows: [][]string{},
 	}
 
-	for _, machine := range keys {
-		data = append(data, []string{
-			machine.Name,
-			humanize.Time(machine.CreatedAt),
+	for i, key := range keys {
+		view := newKeyView(key)
+		listing.Items.([]keyView)[i] = view
+
+		fingerprint := view.Fingerprint
+		if hash == "md5" {
+			fingerprint = view.FingerprintMD5
+		}
+
+		bits := ""
+		if view.Bits != 0 {
+			bits = strconv.Itoa(view.Bits)
+		}
+
+		listing.Rows = append(listing.Rows, []string{
+			view.Name,
+			view.Type,
+			bits,
+			fingerprint,
+			humanize.Time(view.CreatedAt),
+		})
+		listing.CSVRows = append(listing.CSVRows, []string{
+			view.Name,
+			view.Type,
+			bits,
+			view.Fingerprint,
+			view.FingerprintMD5,
+			view.CreatedAt.Format(time.RFC3339),
 		})
 	}
 
-	command.PrintTable(vikingCli.Out, data)
-
-	return nil
+	return command.PrintListing(vikingCli.Out, format, listing)
 }
@@ -1,6 +1,8 @@
 package key
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/d3witt/viking/cli/command"
@@ -13,13 +15,46 @@ func NewRmCmd(vikingCli *command.Cli) *cli.Command {
 		Usage:     "Remove a key",
 		Args:      true,
 		ArgsUsage: "NAME",
+		Description: "The key is only removed from this computer, it stays authorized on the machines. With --revoke, " +
+			"it is first revoked on all machines, see viking key revoke, and kept when that fails on any host.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "revoke",
+				Usage: "Revoke the key on all machines before removing it",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Do not ask for confirmation, with --revoke",
+			},
+		},
 		Action: func(ctx *cli.Context) error {
 			name := ctx.Args().First()
+
+			if ctx.Bool("revoke") {
+				ok, err := revokeAll(ctx.Context, vikingCli, name, ctx.Bool("force"))
+				if errors.Is(err, errRevokeFailed) {
+					fmt.Fprintf(vikingCli.Err, "Key %s kept, it could not be revoked on all hosts.\n", name)
+				}
+
+				if err != nil || !ok {
+					return err
+				}
+			}
+
 			return runRemove(vikingCli, name)
 		},
 	}
 }
 
+// revokeAll revokes the key on all machines, see runRevoke.
+func revokeAll(ctx context.Context, vikingCli *command.Cli, name string, force bool) (bool, error) {
+	if len(vikingCli.Config.ListMachines()) == 0 {
+		return true, nil
+	}
+
+	return runRevoke(ctx, vikingCli, name, allMachines, revokeOptions{Force: force})
+}
+
 func runRemove(vikingCli *command.Cli, name string) error {
 	if err := vikingCli.Config.RemoveKey(name); err != nil {
 		return err
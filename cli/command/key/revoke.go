@@ -0,0 +1,184 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+// allMachines is the selector matching every machine.
+const allMachines = "*"
+
+func NewRevokeCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "revoke",
+		Usage:     "Remove a key from the authorized keys of machines",
+		Args:      true,
+		ArgsUsage: "KEY [MACHINE|SELECTOR]",
+		Description: "Connects to every selected host and removes the entries of the public key from " +
+			"~/.ssh/authorized_keys. The key stays in the config, see viking key rm --revoke.\n\n" +
+			"Hosts that connect with the key itself cannot be reached with it anymore once it is revoked, " +
+			"viking warns about them before revoking. Switch them to another key first, see viking key deploy " +
+			"--switch, or use viking key rotate.\n\n" +
+			"Examples:\n" +
+			"  viking key revoke starkey deathstar\n" +
+			"  viking key revoke --all starkey\n" +
+			"  viking key revoke --user app starkey role=web",
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Revoke the key on all machines",
+			},
+			&cli.StringFlag{
+				Name:    "user",
+				Aliases: []string{"u"},
+				Usage:   "Remote user to revoke the key for, the connecting user by default",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Do not ask for confirmation",
+			},
+		}, command.RunFlags()...),
+		Action: func(ctx *cli.Context) error {
+			selector := ctx.Args().Get(1)
+
+			switch {
+			case ctx.NArg() == 0 || ctx.NArg() > 2:
+				return fmt.Errorf("expected 1 or 2 arguments, got %d", ctx.NArg())
+			case ctx.Bool("all") && selector != "":
+				return errors.New("--all cannot be used with MACHINE|SELECTOR")
+			case ctx.Bool("all"):
+				selector = allMachines
+			case selector == "":
+				return errors.New("MACHINE|SELECTOR or --all is required")
+			}
+
+			run, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			opts := revokeOptions{
+				User:  ctx.String("user"),
+				Force: ctx.Bool("force"),
+				Run:   run,
+			}
+
+			_, err = runRevoke(ctx.Context, vikingCli, ctx.Args().First(), selector, opts)
+
+			return err
+		},
+	}
+}
+
+type revokeOptions struct {
+	User  string
+	Force bool
+	Run   command.RunOptions
+}
+
+// errRevokeFailed is returned by runRevoke when the key could not be revoked
+// on some hosts, the errors of the hosts being printed already.
+var errRevokeFailed = cli.Exit("", 1)
+
+// runRevoke revokes the key on the selected hosts. It reports whether the
+// key was revoked on all of them, false without error meaning the user did
+// not confirm.
+func runRevoke(ctx context.Context, vikingCli *command.Cli, name, selector string, opts revokeOptions) (bool, error) {
+	key, err := vikingCli.Config.GetKeyByName(name)
+	if err != nil {
+		return false, err
+	}
+
+	if _, _, err := publicKey(key); err != nil {
+		return false, err
+	}
+
+	if opts.User != "" && !validRemoteUser(opts.User) {
+		return false, fmt.Errorf("invalid user %q", opts.User)
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	targets, err := vikingCli.MachineTargets(selector)
+	defer func() {
+		for _, target := range targets {
+			target.Close()
+		}
+	}()
+
+	if err != nil {
+		return false, err
+	}
+
+	warnLockout(vikingCli, targets, name, opts.User)
+
+	if !opts.Force {
+		ok, err := command.PromptForConfirmation(vikingCli.In, vikingCli.Out, fmt.Sprintf("Revoke key %s on %d hosts?", name, len(targets)))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	ran := make([]bool, len(targets))
+
+	errs := vikingCli.RunTargets(ctx, targets, opts.Run, func(ctx context.Context, i int, target command.Target) error {
+		ran[i] = true
+		label := targetLabel(target)
+
+		removed, err := revokeKey(ctx, target, key, opts.User)
+		if err != nil {
+			fmt.Fprintf(vikingCli.Err, "%s: error: %v\n", label, err)
+			return err
+		}
+
+		if removed {
+			fmt.Fprintf(vikingCli.Out, "%s: key %s removed.\n", label, name)
+		} else {
+			fmt.Fprintf(vikingCli.Out, "%s: key %s was not authorized.\n", label, name)
+		}
+
+		return nil
+	})
+
+	// Errors of hosts that were not run were not printed while running.
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			if !ran[i] {
+				fmt.Fprintf(vikingCli.Err, "%s: %v\n", targetLabel(targets[i]), err)
+			}
+		}
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Key %s revoked on %d of %d hosts.\n", name, len(targets)-failed, len(targets))
+
+	if failed > 0 {
+		return false, errRevokeFailed
+	}
+
+	return true, nil
+}
+
+// warnLockout warns about the targets viking connects to with the key, which
+// it cannot reach anymore once the key is revoked for their user.
+func warnLockout(vikingCli *command.Cli, targets []command.Target, name, user string) {
+	var lockedOut []string
+	for _, target := range targets {
+		if target.Host.Key == name && (user == "" || user == target.Host.User) {
+			lockedOut = append(lockedOut, targetLabel(target))
+		}
+	}
+
+	if len(lockedOut) > 0 {
+		fmt.Fprintf(vikingCli.Err, "Warning: viking connects to these hosts with key %s, revoking it will lock it out:\n", name)
+		for _, label := range lockedOut {
+			fmt.Fprintf(vikingCli.Err, "  %s\n", label)
+		}
+	}
+}
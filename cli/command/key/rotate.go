@@ -0,0 +1,465 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshexec"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// rollbackTimeout limits the time spent removing the new key from a host
+// after a failure, which is done even when viking is interrupted.
+const rollbackTimeout = 30 * time.Second
+
+func NewRotateCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "rotate",
+		Usage:     "Replace a key on all hosts using it",
+		Args:      true,
+		ArgsUsage: "OLD",
+		Description: "Every host using the key OLD is rotated to the new key in four steps:\n\n" +
+			"  1. the new key is authorized on the host, connecting with OLD\n" +
+			"  2. a login with the new key is verified\n" +
+			"  3. the host is switched to the new key in the config\n" +
+			"  4. OLD is removed from the authorized keys of the host\n\n" +
+			"When a step before the switch fails, the new key is removed from the host again and the host keeps " +
+			"using OLD. Hosts with --resolve-all are only switched when all their addresses succeed. Jump hosts " +
+			"given as specs keep logging in with OLD, see viking machine edit --jump-key.\n\n" +
+			"Without --new, a key named OLD-YYYYMMDD is generated. A generated key has the type and size of OLD, " +
+			"unless --type or --bits are given, and the passphrase of OLD. OLD is kept in the config, remove it with " +
+			"viking key rm once no host uses it.",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "new",
+				Aliases: []string{"n"},
+				Usage:   "Name of the new key, generated if it does not exist",
+			},
+			&cli.StringFlag{
+				Name:    "type",
+				Aliases: []string{"t"},
+				Usage:   "Type of a generated key: ed25519, ecdsa or rsa",
+			},
+			&cli.IntFlag{
+				Name:    "bits",
+				Aliases: []string{"b"},
+				Usage:   "Size of a generated key, see viking key generate",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show the hosts that would be rotated and stop",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Do not ask for confirmation",
+			},
+		}, command.RunFlags()...),
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			run, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			opts := rotateOptions{
+				New:    ctx.String("new"),
+				Type:   ctx.String("type"),
+				Bits:   ctx.Int("bits"),
+				DryRun: ctx.Bool("dry-run"),
+				Force:  ctx.Bool("force"),
+				Run:    run,
+			}
+
+			return runRotate(ctx.Context, vikingCli, ctx.Args().First(), opts)
+		},
+	}
+}
+
+type rotateOptions struct {
+	New    string
+	Type   string
+	Bits   int
+	DryRun bool
+	Force  bool
+	Run    command.RunOptions
+}
+
+// keyHosts returns the hosts using the named key, sorted by machine.
+func keyHosts(cfg *config.Config, name string) []hostRef {
+	machines := cfg.ListMachines()
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	var refs []hostRef
+	for _, m := range machines {
+		for i, host := range m.Hosts {
+			if host.Key == name {
+				refs = append(refs, hostRef{m.Name, i})
+			}
+		}
+	}
+
+	return refs
+}
+
+// jumpKeyUsed reports whether a host logs in to its jump hosts with the named
+// key, see config.Host.JumpKey.
+func jumpKeyUsed(cfg *config.Config, name string) bool {
+	for _, m := range cfg.ListMachines() {
+		for _, host := range m.Hosts {
+			if host.JumpKey == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func runRotate(ctx context.Context, vikingCli *command.Cli, name string, opts rotateOptions) error {
+	oldKey, err := vikingCli.Config.GetKeyByName(name)
+	if err != nil {
+		return err
+	}
+
+	oldPub, _, err := publicKey(oldKey)
+	if err != nil {
+		return err
+	}
+
+	refs := keyHosts(vikingCli.Config, name)
+	if len(refs) == 0 {
+		return fmt.Errorf("key %s is not used by any host", name)
+	}
+
+	newName := opts.New
+	if newName == "" {
+		newName = rotatedKeyName(vikingCli.Config, name)
+	}
+
+	if newName == name {
+		return errors.New("the new key must differ from the old one")
+	}
+
+	newKey, err := vikingCli.Config.GetKeyByName(newName)
+	generate := errors.Is(err, config.ErrKeyNotFound)
+	if err != nil && !generate {
+		return err
+	}
+
+	if !generate && (opts.Type != "" || opts.Bits != 0) {
+		return fmt.Errorf("key %s exists, --type and --bits only apply to generated keys", newName)
+	}
+
+	action := "existing key"
+	if generate {
+		action = "new key"
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Rotating key %s to %s %s on %d hosts:\n", name, action, newName, len(refs))
+	for _, ref := range refs {
+		m, _ := vikingCli.Config.GetMachineByName(ref.machine)
+		host := m.Hosts[ref.index]
+
+		label := ref.machine + "/" + command.HostAddr(host)
+		if host.ResolveAll {
+			label += " (all addresses)"
+		}
+
+		fmt.Fprintf(vikingCli.Out, "  %s\n", label)
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if !opts.Force {
+		ok, err := command.PromptForConfirmation(vikingCli.In, vikingCli.Out, fmt.Sprintf("Rotate key %s on %d hosts?", name, len(refs)))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	var targets []command.Target
+	defer func() {
+		for _, target := range targets {
+			target.Close()
+		}
+	}()
+
+	var verifiers []sshexec.Executor
+	defer func() {
+		for _, exec := range verifiers {
+			exec.Close()
+		}
+	}()
+
+	machines := make(map[string]bool)
+	for _, ref := range refs {
+		if machines[ref.machine] {
+			continue
+		}
+		machines[ref.machine] = true
+
+		machineTargets, err := vikingCli.MachineTargets(ref.machine)
+		for _, target := range machineTargets {
+			if target.Host.Key == name {
+				targets = append(targets, target)
+			} else {
+				target.Close()
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if generate {
+		keyType, bits := opts.Type, opts.Bits
+		if keyType == "" {
+			keyType, bits = rotatedKeyParams(oldPub, opts.Bits)
+		}
+
+		// The new key keeps the passphrase of the old one.
+		decrypted, err := vikingCli.Config.DecryptKey(oldKey)
+		if err != nil {
+			return err
+		}
+
+		if err := runGenerate(vikingCli, newName, keyType, bits, newName, decrypted.Passphrase); err != nil {
+			return err
+		}
+
+		if newKey, err = vikingCli.Config.GetKeyByName(newName); err != nil {
+			return err
+		}
+	} else if _, _, err := publicKey(newKey); err != nil {
+		return err
+	}
+
+	// Jump hosts given as specs keep logging in with OLD, see switchedHost.
+	hosts := make([]config.Host, len(targets))
+	for i, target := range targets {
+		hosts[i] = switchedHost(target.Host, newName, "")
+	}
+
+	if verifiers, err = vikingCli.HostExecutors(hosts); err != nil {
+		return err
+	}
+
+	r := &rotation{
+		vikingCli: vikingCli,
+		oldKey:    oldKey,
+		newKey:    newKey,
+		targets:   targets,
+		verifiers: verifiers,
+		added:     make([]bool, len(targets)),
+		results:   make([]string, len(targets)),
+	}
+
+	rotated := r.run(ctx, opts.Run)
+
+	fmt.Fprintln(vikingCli.Out)
+	data := [][]string{{"HOST", "RESULT"}}
+	for i, target := range targets {
+		data = append(data, []string{targetLabel(target), r.results[i]})
+	}
+	command.PrintTable(vikingCli.Out, data)
+	fmt.Fprintln(vikingCli.Out)
+
+	fmt.Fprintf(vikingCli.Out, "Rotated %d of %d hosts from key %s to %s.\n", rotated, len(refs), name, newName)
+
+	if generate && rotated == 0 && !r.leftover {
+		if err := vikingCli.Config.RemoveKey(newName); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(vikingCli.Out, "Key %s removed, no host uses it.\n", newName)
+	}
+
+	switch {
+	case len(keyHosts(vikingCli.Config, name)) > 0:
+	case jumpKeyUsed(vikingCli.Config, name):
+		fmt.Fprintf(vikingCli.Out, "Key %s is no longer used to log in to hosts, but still to their jump hosts, see viking key usage %s\n", name, name)
+	default:
+		fmt.Fprintf(vikingCli.Out, "Key %s is no longer used by any host, remove it with: viking key rm %s\n", name, name)
+	}
+
+	if r.failed {
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+// rotatedKeyName returns the default name of the key replacing old.
+func rotatedKeyName(cfg *config.Config, old string) string {
+	base := old + "-" + time.Now().Format("20060102")
+
+	name := base
+	for i := 2; ; i++ {
+		if _, err := cfg.GetKeyByName(name); err != nil {
+			return name
+		}
+
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// rotatedKeyParams returns the type and size of the key generated to
+// replace old: the same as old when viking can generate such keys, with bits
+// overriding the size, and ed25519 otherwise.
+func rotatedKeyParams(old ssh.PublicKey, bits int) (string, int) {
+	keyType, oldBits := keyParams(old)
+
+	switch {
+	case keyType == "":
+		return "ed25519", 0
+	case bits != 0:
+		return keyType, bits
+	case keyType == "rsa" && oldBits < minRSABits:
+		return keyType, defaultRSABits
+	default:
+		return keyType, oldBits
+	}
+}
+
+// rotation rotates the key of targets, see NewRotateCmd.
+type rotation struct {
+	vikingCli *command.Cli
+	oldKey    config.Key
+	newKey    config.Key
+	targets   []command.Target
+	// verifiers connect to the targets with the new key.
+	verifiers []sshexec.Executor
+	// added is set for the targets where the new key was added, as opposed
+	// to already authorized.
+	added   []bool
+	results []string
+	// failed is set when any host was not fully rotated.
+	failed bool
+	// leftover is set when the new key could not be removed from a host.
+	leftover bool
+}
+
+// run rotates the targets and returns the number of hosts rotated.
+func (r *rotation) run(ctx context.Context, opts command.RunOptions) int {
+	out := r.vikingCli.Out
+	newName := r.newKey.Name
+
+	// Authorize the new key and verify it works.
+	errs := r.vikingCli.RunTargets(ctx, r.targets, opts, func(ctx context.Context, i int, target command.Target) error {
+		label := targetLabel(target)
+
+		added, err := deployKey(ctx, target, r.newKey, "")
+		if err != nil {
+			err = fmt.Errorf("failed to authorize key %s: %w", newName, err)
+			fmt.Fprintf(r.vikingCli.Err, "%s: error: %v\n", label, err)
+			return err
+		}
+		r.added[i] = added
+
+		if err := verifyLogin(ctx, r.verifiers[i]); err != nil {
+			err = fmt.Errorf("login with key %s failed: %w", newName, err)
+			fmt.Fprintf(r.vikingCli.Err, "%s: error: %v\n", label, err)
+			return err
+		}
+
+		fmt.Fprintf(out, "%s: key %s authorized and verified.\n", label, newName)
+
+		return nil
+	})
+
+	// Switch the hosts that succeeded, roll back the others.
+	refs, groups := groupTargets(r.targets)
+
+	var switched []command.Target
+	var switchedIndex []int
+	rotated := 0
+
+	for _, ref := range refs {
+		indexes := groups[ref]
+
+		err := errors.New("another address of the host failed")
+		if succeeded(errs, indexes) {
+			err = switchHost(r.vikingCli, ref, newName, "")
+		}
+
+		if err != nil {
+			r.failed = true
+			for _, i := range indexes {
+				cause := err
+				if errs[i] != nil {
+					cause = errs[i]
+				}
+
+				r.results[i] = r.rollback(ctx, i, cause)
+			}
+			continue
+		}
+
+		rotated++
+		for _, i := range indexes {
+			target := r.targets[i]
+			target.Executor = r.verifiers[i]
+
+			switched = append(switched, target)
+			switchedIndex = append(switchedIndex, i)
+		}
+	}
+
+	// Revoke the old key, connected with the new one.
+	errs = r.vikingCli.RunTargets(ctx, switched, opts, func(ctx context.Context, i int, target command.Target) error {
+		_, err := revokeKey(ctx, target, r.oldKey, "")
+		return err
+	})
+
+	for j, err := range errs {
+		i := switchedIndex[j]
+		if err != nil {
+			r.failed = true
+			r.results[i] = fmt.Sprintf("rotated, but key %s is still authorized: %v", r.oldKey.Name, err)
+			continue
+		}
+
+		r.results[i] = "rotated"
+	}
+
+	return rotated
+}
+
+// rollback removes the new key from the i-th target if it was added, and
+// returns the result of the target that failed with err.
+func (r *rotation) rollback(ctx context.Context, i int, err error) string {
+	if !r.added[i] {
+		return fmt.Sprintf("not rotated: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	if _, rbErr := revokeKey(ctx, r.targets[i], r.newKey, ""); rbErr != nil {
+		r.leftover = true
+		return fmt.Sprintf("not rotated: %v, rollback failed, key %s is still authorized: %v", err, r.newKey.Name, rbErr)
+	}
+
+	return fmt.Sprintf("rolled back: %v", err)
+}
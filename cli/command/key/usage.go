@@ -0,0 +1,132 @@
+package key
+
+import (
+	"sort"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewUsageCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "usage",
+		Usage:     "Show the machines using a key",
+		Args:      true,
+		ArgsUsage: "KEY",
+		Description: "Lists the hosts that log in with the key, and the hosts reached through a jump host " +
+			"logging in with the key: a jump machine using it, or a jump host given as spec with the key as " +
+			"jump key, see viking machine edit --jump-key.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   command.FormatUsage,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			return listUsage(vikingCli, ctx.Args().First(), ctx.String("format"))
+		},
+	}
+}
+
+// usageView is a host using a key.
+type usageView struct {
+	Machine string `json:"machine" yaml:"machine"`
+	Address string `json:"address" yaml:"address"`
+	Port    int    `json:"port" yaml:"port"`
+	User    string `json:"user" yaml:"user"`
+	// Jump is the jump machine or spec using the key, empty when the host
+	// itself does.
+	Jump string `json:"jump,omitempty" yaml:"jump,omitempty"`
+}
+
+func listUsage(vikingCli *command.Cli, name, format string) error {
+	if _, err := vikingCli.Config.GetKeyByName(name); err != nil {
+		return err
+	}
+
+	machines := vikingCli.Config.ListMachines()
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	listing := command.Listing{
+		Items: []usageView{},
+		Header: []string{
+			"MACHINE",
+			"HOST",
+			"USER",
+			"USAGE",
+		},
+	}
+
+	for _, m := range machines {
+		for _, host := range m.EffectiveHosts() {
+			view := usageView{
+				Machine: m.Name,
+				Address: host.Address,
+				Port:    host.Port,
+				User:    host.User,
+			}
+
+			usage := "login"
+			if host.Key != name {
+				view.Jump = jumpUsing(vikingCli.Config, config.SplitJump(host.Jump), host.EffectiveJumpKey(), name, 0)
+				if view.Jump == "" {
+					continue
+				}
+
+				usage = "jump via " + view.Jump
+			}
+
+			listing.Items = append(listing.Items.([]usageView), view)
+			listing.Rows = append(listing.Rows, []string{
+				view.Machine,
+				command.HostAddr(host),
+				view.User,
+				usage,
+			})
+		}
+	}
+
+	return command.PrintListing(vikingCli.Out, format, listing)
+}
+
+// jumpUsing returns the first jump host of the chain that logs in with the
+// named key, following the jump hosts of the first jump machine like viking
+// does when connecting. jumpKey is the key of the specs of the chain.
+func jumpUsing(cfg *config.Config, chain []string, jumpKey, name string, depth int) string {
+	if depth >= command.MaxJumpDepth {
+		return ""
+	}
+
+	for i, jump := range chain {
+		m, err := cfg.GetMachineByName(jump)
+		if err != nil {
+			if jumpKey == name {
+				return jump
+			}
+
+			continue
+		}
+
+		if len(m.Hosts) == 0 {
+			continue
+		}
+
+		host := m.EffectiveHosts()[0]
+		if host.Key == name {
+			return m.Name
+		}
+
+		if i == 0 {
+			if via := jumpUsing(cfg, config.SplitJump(host.Jump), host.EffectiveJumpKey(), name, depth+1); via != "" {
+				return via
+			}
+		}
+	}
+
+	return ""
+}
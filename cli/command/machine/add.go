@@ -1,25 +1,24 @@
 package machine
 
 import (
-	"errors"
 	"fmt"
 	"net"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/cli/command/hostkey"
 	"github.com/d3witt/viking/config"
 	"github.com/urfave/cli/v2"
 )
 
 func NewAddCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
-		Name:        "add",
-		Usage:       "Add a new machine",
-		Description: "This command adds a new machine to the list of machines. No action is taken on the machine itself. Ensure your computer has SSH access to this machine.",
-		Args:        true,
-		ArgsUsage:   "[USER@]HOST[:PORT]...",
+		Name:      "add",
+		Usage:     "Add a new machine",
+		Args:      true,
+		ArgsUsage: "[USER@]HOST[:PORT]...",
+		Description: "This command adds a new machine to the list of machines. No action is taken on the machine itself. Ensure your computer has SSH access to this machine.\n\n" +
+			"HOST is a hostname or an IP address, resolved when connecting. IPv6 addresses with a port must be enclosed in brackets, e.g. root@[2001:db8::1]:2222.",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "name",
@@ -42,6 +41,19 @@ func NewAddCmd(vikingCli *command.Cli) *cli.Command {
 				Aliases: []string{"p"},
 				Value:   22,
 			},
+			&cli.StringFlag{
+				Name:    "jump",
+				Aliases: []string{"J"},
+				Usage:   "Jump hosts to connect through, comma separated machine names or [USER@]HOST[:PORT] specs",
+			},
+			&cli.BoolFlag{
+				Name:  "resolve-all",
+				Usage: "Connect to every A and AAAA record of the hostnames, looked up when connecting",
+			},
+			&cli.BoolFlag{
+				Name:  "scan",
+				Usage: "Fetch and pin the host keys of all hosts",
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 			hosts := ctx.Args().Slice()
@@ -49,41 +61,48 @@ func NewAddCmd(vikingCli *command.Cli) *cli.Command {
 			user := ctx.String("user")
 			key := ctx.String("key")
 			port := ctx.Int("port")
+			jump := ctx.String("jump")
+			resolveAll := ctx.Bool("resolve-all")
+			scan := ctx.Bool("scan")
 
-			return runAdd(vikingCli, hosts, port, name, user, key)
+			return runAdd(vikingCli, hosts, port, name, user, key, jump, resolveAll, scan)
 		},
 	}
 }
 
-func parseMachine(val, defaultUser string, defaultPort int) (user string, ip net.IP, port int, err error) {
-	user = defaultUser
-	port = defaultPort
-
-	if idx := strings.Index(val, "@"); idx != -1 {
-		user = val[:idx]
-		val = val[idx+1:]
+func parseMachine(val, defaultUser string, defaultPort int) (user, host string, port int, err error) {
+	user, host, port, err = command.ParseHostSpec(val, defaultUser, defaultPort)
+	if err != nil {
+		return
 	}
 
-	host, portStr, splitErr := net.SplitHostPort(val)
-	if splitErr != nil {
-		host = val
-	} else {
-		port, err = strconv.Atoi(portStr)
+	err = config.ValidateAddress(host)
+
+	return
+}
+
+// parseHosts parses [USER@]HOST[:PORT] specs into hosts using key.
+func parseHosts(specs []string, user string, port int, key string, resolveAll bool) ([]config.Host, error) {
+	hosts := make([]config.Host, 0, len(specs))
+	for _, spec := range specs {
+		user, addr, port, err := parseMachine(spec, user, port)
 		if err != nil {
-			err = errors.New("invalid port number")
-			return
+			return nil, err
 		}
-	}
 
-	ip = net.ParseIP(host)
-	if ip == nil {
-		err = errors.New("invalid IP address")
+		hosts = append(hosts, config.Host{
+			Address:    addr,
+			Port:       port,
+			User:       user,
+			Key:        key,
+			ResolveAll: resolveAll && net.ParseIP(addr) == nil,
+		})
 	}
 
-	return
+	return hosts, nil
 }
 
-func runAdd(vikingCli *command.Cli, hosts []string, port int, name, user, key string) error {
+func runAdd(vikingCli *command.Cli, hosts []string, port int, name, user, key, jump string, resolveAll, scan bool) error {
 	if name == "" {
 		name = command.GenerateRandomName()
 	}
@@ -97,22 +116,26 @@ func runAdd(vikingCli *command.Cli, hosts []string, port int, name, user, key st
 
 	m := config.Machine{
 		Name:      name,
-		Hosts:     []config.Host{},
 		CreatedAt: time.Now(),
+		Jump:      jump,
+	}
+
+	var err error
+	if m.Hosts, err = parseHosts(hosts, user, port, key, resolveAll); err != nil {
+		return err
 	}
 
-	for _, host := range hosts {
-		user, hostIp, port, err := parseMachine(host, user, port)
+	if scan {
+		hosts, err := command.ResolveHosts(m.EffectiveHosts())
 		if err != nil {
 			return err
 		}
 
-		m.Hosts = append(m.Hosts, config.Host{
-			IP:   hostIp,
-			Port: port,
-			User: user,
-			Key:  key,
-		})
+		for _, host := range hosts {
+			if err := hostkey.Pin(vikingCli, host, false); err != nil {
+				return err
+			}
+		}
 	}
 
 	if err := vikingCli.Config.AddMachine(m); err != nil {
@@ -2,17 +2,16 @@ package machine
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/d3witt/viking/archive"
 	"github.com/d3witt/viking/cli/command"
-	"github.com/d3witt/viking/sshexec"
 	"github.com/schollz/progressbar/v3"
 	"github.com/urfave/cli/v2"
 )
@@ -24,12 +23,21 @@ func NewCopyCmd(vikingCli *command.Cli) *cli.Command {
 		Usage:     "Copy files/folders between local and remote machine",
 		Args:      true,
 		ArgsUsage: "MACHINE:SRC_PATH DEST_PATH | SRC_PATH MACHINE:DEST_PATH",
+		Description: "MACHINE can also be a selector, such as role=web,region=eu. See viking machine ls --help.\n\n" +
+			"When copying from several hosts, the files of every host are stored in a directory " +
+			"MACHINE_ADDRESS_PORT of DEST_PATH.",
+		Flags: command.RunFlags(),
 		Action: func(ctx *cli.Context) error {
 			if ctx.NArg() != 2 {
 				return fmt.Errorf("expected 2 arguments, got %d", ctx.NArg())
 			}
 
-			return runCopy(vikingCli, ctx.Args().Get(0), ctx.Args().Get(1))
+			opts, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			return runCopy(ctx.Context, vikingCli, ctx.Args().Get(0), ctx.Args().Get(1), opts)
 		},
 	}
 }
@@ -43,7 +51,7 @@ func parseMachinePath(fullPath string) (machine, path string) {
 	return "", fullPath
 }
 
-func runCopy(vikingCli *command.Cli, from, to string) error {
+func runCopy(ctx context.Context, vikingCli *command.Cli, from, to string, opts command.RunOptions) error {
 	fromMachine, fromPath := parseMachinePath(from)
 	toMachine, toPath := parseMachinePath(to)
 
@@ -57,10 +65,13 @@ func runCopy(vikingCli *command.Cli, from, to string) error {
 
 	machine := fromMachine + toMachine
 
-	execs, err := vikingCli.MachineExecuters(machine)
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	targets, err := vikingCli.MachineTargets(machine)
 	defer func() {
-		for _, exec := range execs {
-			exec.Close()
+		for _, target := range targets {
+			target.Close()
 		}
 	}()
 
@@ -69,13 +80,13 @@ func runCopy(vikingCli *command.Cli, from, to string) error {
 	}
 
 	if fromMachine != "" {
-		return copyFromRemote(vikingCli, execs, fromPath, toPath)
+		return copyFromRemote(ctx, vikingCli, targets, fromPath, toPath, opts)
 	}
 
-	return copyToRemote(vikingCli, execs, fromPath, toPath)
+	return copyToRemote(ctx, vikingCli, targets, fromPath, toPath, opts)
 }
 
-func copyToRemote(vikingCli *command.Cli, execs []sshexec.Executor, from, to string) error {
+func copyToRemote(ctx context.Context, vikingCli *command.Cli, targets []command.Target, from, to string, opts command.RunOptions) error {
 	data, err := archive.Tar(from)
 	if err != nil {
 		return err
@@ -99,120 +110,100 @@ func copyToRemote(vikingCli *command.Cli, execs []sshexec.Executor, from, to str
 		return err
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var errorMessages []string
-
-	wg.Add(len(execs))
-
 	bar := copyProgressBar(
 		vikingCli.Out,
-		written*int64(len(execs)),
+		written*int64(len(targets)),
 		"Sending",
 	)
 
-	for _, exec := range execs {
-		go func(exec sshexec.Executor) {
-			defer wg.Done()
-
-			// Open the temporary file for reading
-			tmpFile, err := os.Open(tmpFile.Name())
-			if err != nil {
-				mu.Lock()
-				errorMessages = append(errorMessages, fmt.Sprintf("Error opening temporary file: %v", err))
-				mu.Unlock()
-				return
-			}
-			defer tmpFile.Close()
-
-			// Create a multi-reader to read from the file and update the progress bar
-			reader := io.TeeReader(tmpFile, bar)
-
-			if err := archive.UntarRemote(exec, to, reader); err != nil {
-				mu.Lock()
-				errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", exec.Addr(), err))
-				mu.Unlock()
-				return
-			}
-		}(exec)
-	}
+	errs := vikingCli.RunTargets(ctx, targets, opts, func(ctx context.Context, i int, target command.Target) error {
+		// Open the temporary file for reading
+		tmpFile, err := os.Open(tmpFile.Name())
+		if err != nil {
+			return fmt.Errorf("error opening temporary file: %w", err)
+		}
+		defer tmpFile.Close()
 
-	wg.Wait()
+		// Create a multi-reader to read from the file and update the progress bar
+		reader := io.TeeReader(tmpFile, bar)
 
-	printCopyStatus(vikingCli.Out, len(execs), errorMessages)
+		return archive.UntarRemote(ctx, target, to, reader)
+	})
 
-	return nil
+	return printCopyStatus(vikingCli.Out, targets, errs)
 }
 
-func copyFromRemote(vikingCli *command.Cli, execs []sshexec.Executor, from, to string) error {
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var errorMessages []string
-
-	wg.Add(len(execs))
-
+func copyFromRemote(ctx context.Context, vikingCli *command.Cli, targets []command.Target, from, to string, opts command.RunOptions) error {
 	bar := copyProgressBar(
 		vikingCli.Out,
 		-1,
 		"Receiving",
 	)
 
-	for _, exec := range execs {
-		go func(exec sshexec.Executor) {
-			defer wg.Done()
+	errs := vikingCli.RunTargets(ctx, targets, opts, func(ctx context.Context, i int, target command.Target) error {
+		dest := to
+		if len(targets) > 1 {
+			dest = path.Join(to, hostDir(target))
+		}
 
-			dest := to
-			if len(execs) > 1 {
-				dest = path.Join(to, exec.Addr())
-			}
+		data, err := archive.TarRemote(ctx, target, from)
+		if err != nil {
+			return err
+		}
 
-			data, err := archive.TarRemote(exec, from)
-			if err != nil {
-				mu.Lock()
-				errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", exec.Addr(), err))
-				mu.Unlock()
-				return
-			}
+		reader := io.TeeReader(data, bar)
 
-			reader := io.TeeReader(data, bar)
+		buf := new(bytes.Buffer)
+		if _, err := buf.ReadFrom(reader); err != nil {
+			return err
+		}
 
-			buf := new(bytes.Buffer)
-			_, err = buf.ReadFrom(reader)
-			if err != nil {
-				mu.Lock()
-				errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", exec.Addr(), err))
-				mu.Unlock()
-				return
-			}
+		if err := archive.Untar(buf, dest); err != nil {
+			return fmt.Errorf("error untar to %s: %w", dest, err)
+		}
 
-			if err := archive.Untar(buf, dest); err != nil {
-				mu.Lock()
-				errorMessages = append(errorMessages, fmt.Sprintf("Error untar to %s: %v", dest, err))
-				mu.Unlock()
-				return
-			}
-		}(exec)
-	}
+		return nil
+	})
 
-	wg.Wait()
 	bar.Finish()
 
-	printCopyStatus(vikingCli.Out, len(execs), errorMessages)
+	return printCopyStatus(vikingCli.Out, targets, errs)
+}
 
-	return nil
+// hostDir returns the directory of DEST_PATH receiving the files of target
+// when copying from several hosts. It is unique for every machine, address
+// and port, the same address may be reached on several ports or through
+// different jump hosts.
+func hostDir(target command.Target) string {
+	name := fmt.Sprintf("%s_%s_%d", target.Machine, target.Host.Address, target.Host.Port)
+
+	return strings.NewReplacer("/", "_", `\`, "_", ":", "_").Replace(name)
 }
 
-func printCopyStatus(out io.Writer, total int, errorMessages []string) {
+// printCopyStatus prints the copy summary and returns an error making viking
+// exit with 1 when any host failed or was skipped.
+func printCopyStatus(out io.Writer, targets []command.Target, errs []error) error {
+	var errorMessages []string
+	for i, err := range errs {
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", targets[i].Addr(), err))
+		}
+	}
+
 	errCount := len(errorMessages)
 
-	fmt.Fprintf(out, "Success: %d, Errors: %d\n", total-errCount, errCount)
+	fmt.Fprintf(out, "Success: %d, Errors: %d\n", len(targets)-errCount, errCount)
 
 	if len(errorMessages) > 0 {
 		fmt.Fprintln(out, "Error details:")
 		for _, message := range errorMessages {
 			fmt.Fprintln(out, message)
 		}
+
+		return cli.Exit("", 1)
 	}
+
+	return nil
 }
 
 func copyProgressBar(out io.Writer, maxBytes int64, message string) *progressbar.ProgressBar {
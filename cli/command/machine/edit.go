@@ -0,0 +1,156 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewEditCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "edit",
+		Usage: "Change the user, key, port or jump hosts of a machine",
+		Description: "Changes apply to all hosts of the machine, or to a single host with --host. Pass an empty key (--key \"\") to use the SSH agent.\n\n" +
+			"Jump hosts given as [USER@]HOST[:PORT] specs log in with --jump-key, or with --key when it is not set. " +
+			"Jump machines log in with their own key.",
+		Args:      true,
+		ArgsUsage: "NAME",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Edit only the host with this address (HOST or HOST:PORT)",
+			},
+			&cli.StringFlag{
+				Name:    "user",
+				Aliases: []string{"u"},
+				Usage:   "SSH user name",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "SSH key name",
+			},
+			&cli.IntFlag{
+				Name:    "port",
+				Aliases: []string{"p"},
+				Usage:   "SSH port",
+			},
+			&cli.StringFlag{
+				Name:    "jump",
+				Aliases: []string{"J"},
+				Usage:   "Jump hosts to connect through, comma separated machine names or [USER@]HOST[:PORT] specs",
+			},
+			&cli.StringFlag{
+				Name:  "jump-key",
+				Usage: "SSH key name for the jump hosts given as specs, empty to use --key",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			var changes hostChanges
+			if ctx.IsSet("user") {
+				changes.User = ptr(ctx.String("user"))
+			}
+			if ctx.IsSet("key") {
+				changes.Key = ptr(ctx.String("key"))
+			}
+			if ctx.IsSet("port") {
+				changes.Port = ptr(ctx.Int("port"))
+			}
+			if ctx.IsSet("jump") {
+				changes.Jump = ptr(ctx.String("jump"))
+			}
+			if ctx.IsSet("jump-key") {
+				changes.JumpKey = ptr(ctx.String("jump-key"))
+			}
+
+			return runEdit(vikingCli, ctx.Args().First(), ctx.String("host"), changes)
+		},
+	}
+}
+
+// hostChanges are the fields to change, nil fields are kept.
+type hostChanges struct {
+	User    *string
+	Key     *string
+	Port    *int
+	Jump    *string
+	JumpKey *string
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func runEdit(vikingCli *command.Cli, name, host string, changes hostChanges) error {
+	if changes == (hostChanges{}) {
+		return errors.New("nothing to change, see viking machine edit --help")
+	}
+
+	if changes.User != nil && *changes.User == "" {
+		return errors.New("user must not be empty")
+	}
+
+	if changes.Port != nil && (*changes.Port <= 0 || *changes.Port > 65535) {
+		return fmt.Errorf("invalid port %d", *changes.Port)
+	}
+
+	for _, key := range []*string{changes.Key, changes.JumpKey} {
+		if key != nil && *key != "" {
+			if _, err := vikingCli.Config.GetKeyByName(*key); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := vikingCli.Config.UpdateMachine(name, func(m *config.Machine) error {
+		hosts := m.Hosts
+		if host != "" {
+			i, err := m.FindHost(host)
+			if err != nil {
+				return err
+			}
+
+			hosts = m.Hosts[i : i+1]
+		} else if changes.Jump != nil {
+			// The machine jump hosts apply to hosts without their own.
+			m.Jump = *changes.Jump
+			for i := range hosts {
+				hosts[i].Jump = ""
+			}
+		}
+
+		for i := range hosts {
+			if changes.User != nil {
+				hosts[i].User = *changes.User
+			}
+			if changes.Key != nil {
+				hosts[i].Key = *changes.Key
+			}
+			if changes.Port != nil {
+				hosts[i].Port = *changes.Port
+			}
+			if changes.Jump != nil && host != "" {
+				hosts[i].Jump = *changes.Jump
+			}
+			if changes.JumpKey != nil {
+				hosts[i].JumpKey = *changes.JumpKey
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Machine %s updated.\n", name)
+
+	return nil
+}
@@ -1,43 +1,115 @@
 package machine
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 
 	"github.com/d3witt/viking/cli/command"
 	"github.com/d3witt/viking/sshexec"
+	"github.com/d3witt/viking/streams"
 	"github.com/urfave/cli/v2"
 )
 
+// exitConnectionError is the exit code used when the command could not be
+// run on the host at all, like ssh does.
+const exitConnectionError = 255
+
 func NewExecuteCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
 		Name:      "exec",
 		Usage:     "Execute shell command on machine",
-		ArgsUsage: "NAME \"COMMAND\"",
-		Flags: []cli.Flag{
+		ArgsUsage: "MACHINE|SELECTOR \"COMMAND\"",
+		Description: "On a single host, viking exits with the exit status of the remote command, or 255 if it could not be run. " +
+			"On multiple hosts, viking exits with 1 when the command failed on more than --max-failures hosts.\n\n" +
+			"With --output json or jsonl, viking prints one result per host with the fields machine, address, port, exit_status " +
+			"(null if the command could not be run), error, stdout, stderr, start, end and duration (in seconds). " +
+			"json prints an array once all hosts are done, jsonl prints a line as soon as a host is done.",
+		Flags: append([]cli.Flag{
 			&cli.BoolFlag{
 				Name:    "tty",
 				Aliases: []string{"t"},
 				Usage:   "Allocate a pseudo-TTY",
 			},
-		},
+			&cli.IntFlag{
+				Name:  "max-failures",
+				Usage: "Number of hosts allowed to fail before exiting with an error",
+			},
+			&cli.BoolFlag{
+				Name:  "group",
+				Usage: "Buffer the output of every host and print it in one block once the host is done",
+			},
+			&cli.BoolFlag{
+				Name:  "timestamps",
+				Usage: "Prefix every line of multi-host output with the time it was printed",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   outputText,
+				Usage:   "Output format: text, json or jsonl",
+			},
+		}, command.RunFlags()...),
 		Action: func(ctx *cli.Context) error {
 			machine := ctx.Args().First()
 			cmd := strings.Join(ctx.Args().Tail(), " ")
-			tty := ctx.Bool("tty")
 
-			return runExecute(vikingCli, machine, cmd, tty)
+			run, err := command.RunOptionsFromContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			opts := execOptions{
+				TTY:         ctx.Bool("tty"),
+				MaxFailures: ctx.Int("max-failures"),
+				Output:      ctx.String("output"),
+				Timestamps:  ctx.Bool("timestamps"),
+				Group:       ctx.Bool("group"),
+				Run:         run,
+			}
+
+			return runExecute(ctx.Context, vikingCli, machine, cmd, opts)
 		},
 	}
 }
 
-func runExecute(vikingCli *command.Cli, machine string, cmd string, tty bool) error {
-	execs, err := vikingCli.MachineExecuters(machine)
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+type execOptions struct {
+	TTY         bool
+	MaxFailures int
+	Output      string
+	Timestamps  bool
+	Group       bool
+	Run         command.RunOptions
+}
+
+func runExecute(ctx context.Context, vikingCli *command.Cli, machine string, cmd string, opts execOptions) error {
+	if opts.Output != outputText && opts.Output != outputJSON && opts.Output != outputJSONL {
+		return fmt.Errorf("unknown output format %q", opts.Output)
+	}
+
+	// Only an interactive session can run the login shell.
+	if strings.TrimSpace(cmd) == "" && !opts.TTY {
+		return errors.New("command is required, use viking ssh MACHINE to open a shell")
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	targets, err := vikingCli.MachineTargets(machine)
 	defer func() {
-		for _, exec := range execs {
-			exec.Close()
+		for _, target := range targets {
+			target.Close()
 		}
 	}()
 
@@ -45,75 +117,236 @@ func runExecute(vikingCli *command.Cli, machine string, cmd string, tty bool) er
 		return err
 	}
 
-	if tty {
-		if len(execs) != 1 {
+	if opts.TTY {
+		if len(targets) != 1 {
 			return fmt.Errorf("cannot allocate a pseudo-TTY to multiple hosts")
 		}
 
-		return executeTTY(vikingCli, execs[0], cmd)
+		if opts.Output != outputText {
+			return fmt.Errorf("cannot use %s output with a pseudo-TTY", opts.Output)
+		}
+
+		ctx, cancel := opts.Run.TargetContext(ctx)
+		defer cancel()
+
+		return executeTTY(ctx, vikingCli, targets[0], cmd)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(execs))
+	if opts.Output != outputText {
+		return executeJSON(ctx, vikingCli, targets, cmd, opts)
+	}
 
-	for _, exec := range execs {
-		go func(exec sshexec.Executor) {
-			defer wg.Done()
+	var groupMu sync.Mutex
+	labels := targetLabels(targets)
+	ran := make([]bool, len(targets))
 
-			out := vikingCli.Out
-			errOut := vikingCli.Err
-			if len(execs) > 1 {
-				prefix := fmt.Sprintf("%s: ", exec.Addr())
-				out = out.WithPrefix(prefix)
-				errOut = errOut.WithPrefix(prefix + "error: ")
-			}
+	errs := vikingCli.RunTargets(ctx, targets, opts.Run, func(ctx context.Context, i int, target command.Target) error {
+		ran[i] = true
 
-			if err := execute(out, exec, cmd); err != nil {
-				fmt.Fprintln(errOut, err.Error())
-			}
-		}(exec)
+		var out, errOut io.Writer = vikingCli.Out, vikingCli.Err
+		if len(targets) > 1 {
+			prefix := labels[i] + ": "
+
+			outLines := vikingCli.Out.LineWriter(prefix, labels[i])
+			outLines.Timestamps = opts.Timestamps
+			defer outLines.Close()
+
+			errLines := vikingCli.Err.LineWriter(prefix, labels[i])
+			errLines.Timestamps = opts.Timestamps
+			defer errLines.Close()
+
+			out, errOut = outLines, errLines
+		}
+
+		if !opts.Group {
+			err := execute(ctx, out, errOut, target, cmd)
+			printHostError(errOut, err, len(targets))
+			return err
+		}
+
+		// Print the output of the host in one block once it is done.
+		var outBuf, errBuf bytes.Buffer
+		err := execute(ctx, &outBuf, &errBuf, target, cmd)
+
+		groupMu.Lock()
+		defer groupMu.Unlock()
+
+		// Flush partial lines while holding the lock.
+		out.Write(outBuf.Bytes())
+		flushLines(out)
+		errOut.Write(errBuf.Bytes())
+		flushLines(errOut)
+
+		printHostError(errOut, err, len(targets))
+		return err
+	})
+
+	// Errors of hosts that were not run or failed the health check were not
+	// printed while running.
+	for i, err := range errs {
+		if err != nil && (!ran[i] || errors.Is(err, command.ErrHealthCheck)) {
+			fmt.Fprintf(vikingCli.Err, "%s: %v\n", labels[i], err)
+		}
 	}
 
-	wg.Wait()
-	return nil
+	if len(targets) == 1 {
+		return handleSSHError(errs[0])
+	}
+
+	return failuresError(errs, opts.MaxFailures)
 }
 
-func execute(out io.Writer, exec sshexec.Executor, cmd string) error {
-	sshCmd := sshexec.Command(exec, cmd)
+// flushLines writes the pending partial line of a LineWriter.
+func flushLines(w io.Writer) {
+	if lines, ok := w.(*streams.LineWriter); ok {
+		lines.Close()
+	}
+}
 
-	output, err := sshCmd.CombinedOutput()
-	if handleSSHError(err) != nil {
-		return err
+// printHostError prints the error of a host when running on several hosts.
+// On a single host, the error is reported when viking exits.
+func printHostError(errOut io.Writer, err error, hosts int) {
+	if err != nil && hosts > 1 {
+		fmt.Fprintf(errOut, "error: %v\n", err)
 	}
+}
 
-	fmt.Fprint(out, string(output))
-	return nil
+// targetLabels returns the names used to tell the output of targets apart:
+// the host address, with the port if it is not the default one, and the
+// machine name if several machines are involved.
+func targetLabels(targets []command.Target) []string {
+	machines := make(map[string]bool)
+	for _, target := range targets {
+		machines[target.Machine] = true
+	}
+
+	labels := make([]string, len(targets))
+	for i, target := range targets {
+		label := command.HostAddr(target.Host)
+
+		if len(machines) > 1 {
+			label = target.Machine + "/" + label
+		}
+
+		labels[i] = label
+	}
+
+	return labels
+}
+
+// execute runs cmd, streaming its stdout and stderr to out and errOut.
+func execute(ctx context.Context, out, errOut io.Writer, exec sshexec.Executor, cmd string) error {
+	sshCmd := sshexec.CommandContext(ctx, exec, cmd)
+	sshCmd.Stdout = out
+	sshCmd.Stderr = errOut
+
+	return sshCmd.Run()
 }
 
-func executeTTY(vikingCli *command.Cli, exec sshexec.Executor, cmd string) error {
-	sshCmd := sshexec.Command(exec, cmd)
+// executeTTY runs cmd, or the login shell if cmd is empty, in a pseudo-TTY
+// attached to the terminal. The terminal is restored once the session ends,
+// also when it is dropped with the ~. escape sequence or viking panics.
+func executeTTY(ctx context.Context, vikingCli *command.Cli, exec sshexec.Executor, cmd string) error {
+	sshCmd := sshexec.CommandContext(ctx, exec, cmd)
+
+	if term := os.Getenv("TERM"); term != "" {
+		exec.Setenv("TERM", term)
+	}
+
+	// Connect before switching to raw mode so host key prompts stay readable.
+	if err := exec.Connect(); err != nil {
+		return handleSSHError(err)
+	}
 
 	w, h, err := vikingCli.In.Size()
 	if err != nil {
 		return err
 	}
 
-	if err := vikingCli.Out.MakeRaw(); err != nil {
+	if err := vikingCli.In.MakeRaw(); err != nil {
 		return err
 	}
-	defer vikingCli.Out.Restore()
+	defer vikingCli.In.Restore()
 
-	err = sshCmd.RunInteractive(vikingCli.In, vikingCli.Out, vikingCli.Err, w, h)
-	if handleSSHError(err) != nil {
-		return err
+	in := sshexec.NewEscapeReader(vikingCli.In, vikingCli.Err, func() {
+		exec.Close()
+	})
+
+	resizeCtx, stopResize := context.WithCancel(ctx)
+	defer stopResize()
+
+	go vikingCli.In.WatchSize(resizeCtx, func(w, h int) {
+		_ = exec.WindowChange(w, h)
+	})
+
+	err = sshCmd.RunInteractive(in, vikingCli.Out, vikingCli.Err, w, h)
+	stopResize()
+
+	if in.Disconnected() {
+		vikingCli.In.Restore()
+		fmt.Fprintf(vikingCli.Err, "Connection to %s closed.\n", exec.Addr())
+		return cli.Exit("", exitConnectionError)
 	}
 
-	return nil
+	return handleSSHError(err)
 }
 
+// handleSSHError converts the result of a command run on a single host into
+// the error viking exits with: the remote exit status is passed through, and
+// errors that prevented running the command exit with 255.
 func handleSSHError(err error) error {
-	if _, ok := err.(*sshexec.ExitError); ok {
+	if err == nil {
 		return nil
 	}
-	return err
+
+	var exitErr *sshexec.ExitError
+	if errors.As(err, &exitErr) {
+		return cli.Exit("", exitErr.Status)
+	}
+
+	if err := interruptError(err); err != nil {
+		return err
+	}
+
+	return cli.Exit(err, exitConnectionError)
+}
+
+// failuresError returns an error when more than maxFailures hosts failed or
+// hosts were skipped.
+func failuresError(errs []error, maxFailures int) error {
+	failed, skipped := 0, 0
+	for _, err := range errs {
+		if err := interruptError(err); err != nil {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, command.ErrSkipped):
+			skipped++
+		case err != nil:
+			failed++
+		}
+	}
+
+	if failed <= maxFailures && skipped == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("command failed on %d of %d hosts", failed, len(errs))
+	if skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", skipped)
+	}
+
+	return cli.Exit(msg, 1)
+}
+
+// interruptError returns the error viking exits with when err was caused by
+// a signal, or nil.
+func interruptError(err error) error {
+	var interrupt *sshexec.InterruptError
+	if errors.As(err, &interrupt) {
+		return cli.Exit("", command.InterruptExitCode(interrupt.Signal))
+	}
+
+	return nil
 }
@@ -0,0 +1,127 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/sshexec"
+)
+
+type execResult struct {
+	Machine    string    `json:"machine"`
+	Address    string    `json:"address"`
+	Port       int       `json:"port"`
+	ExitStatus *int      `json:"exit_status"`
+	Error      string    `json:"error,omitempty"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Duration   float64   `json:"duration"`
+}
+
+// executeJSON runs cmd on all targets and prints the results as JSON. With
+// lines set, each result is printed on its own line as soon as it is
+// available, otherwise all results are printed as an array at the end.
+func executeJSON(ctx context.Context, vikingCli *command.Cli, targets []command.Target, cmd string, opts execOptions) error {
+	var mu sync.Mutex
+
+	lines := opts.Output == outputJSONL
+	results := make([]execResult, len(targets))
+	enc := json.NewEncoder(vikingCli.Out)
+
+	errs := vikingCli.RunTargets(ctx, targets, opts.Run, func(ctx context.Context, i int, target command.Target) error {
+		var err error
+		results[i], err = executeCapture(ctx, target, cmd)
+
+		if lines {
+			mu.Lock()
+			enc.Encode(results[i])
+			mu.Unlock()
+		}
+
+		return err
+	})
+
+	labels := targetLabels(targets)
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			continue
+		case results[i].Start.IsZero():
+			// The target was not run.
+			results[i] = newExecResult(targets[i])
+			results[i].Error = err.Error()
+
+			if lines {
+				enc.Encode(results[i])
+			}
+		case errors.Is(err, command.ErrHealthCheck):
+			// With lines, the result was printed before the health check ran.
+			if lines {
+				fmt.Fprintf(vikingCli.Err, "%s: %v\n", labels[i], err)
+			} else {
+				results[i].Error = err.Error()
+			}
+		}
+	}
+
+	if !lines {
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+
+	if len(targets) == 1 {
+		return handleSSHError(errs[0])
+	}
+
+	return failuresError(errs, opts.MaxFailures)
+}
+
+func newExecResult(target command.Target) execResult {
+	return execResult{
+		Machine: target.Machine,
+		Address: target.Addr(),
+		Port:    target.Host.Port,
+	}
+}
+
+// executeCapture runs cmd on target, capturing stdout and stderr separately.
+func executeCapture(ctx context.Context, target command.Target, cmd string) (execResult, error) {
+	var stdout, stderr bytes.Buffer
+
+	sshCmd := sshexec.CommandContext(ctx, target, cmd)
+	sshCmd.Stdout = &stdout
+	sshCmd.Stderr = &stderr
+
+	res := newExecResult(target)
+	res.Start = time.Now()
+
+	err := sshCmd.Run()
+
+	res.End = time.Now()
+	res.Duration = res.End.Sub(res.Start).Seconds()
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+
+	var exitErr *sshexec.ExitError
+	switch {
+	case err == nil:
+		status := 0
+		res.ExitStatus = &status
+	case errors.As(err, &exitErr):
+		res.ExitStatus = &exitErr.Status
+	default:
+		res.Error = err.Error()
+	}
+
+	return res, err
+}
@@ -0,0 +1,285 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshconfig"
+	"github.com/urfave/cli/v2"
+)
+
+func NewExportCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "export",
+		Usage:     "Export machines to an ssh config file or an Ansible inventory",
+		Args:      true,
+		ArgsUsage: "[SELECTOR]",
+		Description: "With --ssh-config, the machines are written to stdout as Host blocks of an OpenSSH client config. " +
+			"A machine with one host is exported as a Host named after the machine, a machine with several hosts as " +
+			"NAME-1, NAME-2 and so on.\n\n" +
+			"With --ansible, the machines are written to stdout as the JSON of a dynamic inventory. Tags become groups, " +
+			"KEY=VALUE tags are named KEY_VALUE, and machines with several hosts get a group of their own. To use viking as " +
+			"inventory, make an executable script running viking machine export --ansible and pass it to ansible with -i.\n\n" +
+			"Keys are only referenced by name. Use --identity-dir to write the private keys to a directory and refer to " +
+			"their files.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "ssh-config",
+				Usage: "Export an OpenSSH client config file",
+			},
+			&cli.BoolFlag{
+				Name:  "ansible",
+				Usage: "Export an Ansible dynamic inventory",
+			},
+			&cli.StringFlag{
+				Name:  "identity-dir",
+				Usage: "Write the keys used by the machines to `DIR`",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() > 1 {
+				return fmt.Errorf("expected at most 1 argument, got %d", ctx.NArg())
+			}
+
+			selector := ctx.Args().First()
+			ids := newIdentities(vikingCli.Config, ctx.String("identity-dir"))
+
+			switch {
+			case ctx.Bool("ssh-config") && ctx.Bool("ansible"):
+				return errors.New("--ssh-config and --ansible cannot be used together")
+			case ctx.Bool("ssh-config"):
+				return runExportSSHConfig(vikingCli, selector, ids)
+			case ctx.Bool("ansible"):
+				return runExportAnsible(vikingCli, selector, ids)
+			default:
+				return errors.New("the format to export is required, use --ssh-config or --ansible")
+			}
+		},
+	}
+}
+
+// exportMachines returns the machines matching selector, all of them if it is
+// empty, sorted by name.
+func exportMachines(vikingCli *command.Cli, selector string) ([]config.Machine, error) {
+	var machines []config.Machine
+	if selector == "" {
+		machines = vikingCli.Config.ListMachines()
+	} else {
+		var err error
+		machines, err = vikingCli.Config.SelectMachines(selector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	return machines, nil
+}
+
+func runExportSSHConfig(vikingCli *command.Cli, selector string, ids *identities) error {
+	machines, err := exportMachines(vikingCli, selector)
+	if err != nil {
+		return err
+	}
+
+	// Jump machines are referred to by alias only when they are exported.
+	exported := make(map[string]bool)
+	for _, m := range machines {
+		for i := range m.Hosts {
+			exported[sshAlias(vikingCli.Config, m, i)] = true
+		}
+	}
+
+	var hosts []sshconfig.Host
+	for _, m := range machines {
+		for i, host := range m.EffectiveHosts() {
+			h := sshconfig.Host{
+				Alias:     sshAlias(vikingCli.Config, m, i),
+				HostName:  host.Address,
+				User:      host.User,
+				Port:      host.Port,
+				ProxyJump: proxyJump(vikingCli.Config, host.Jump, exported),
+			}
+
+			var comment []string
+			if tags := config.FormatTags(host.Tags); tags != "" {
+				comment = append(comment, "tags: "+tags)
+			}
+			if host.ResolveAll {
+				comment = append(comment, "viking connects to all addresses of "+host.Address)
+			}
+
+			if host.Key != "" {
+				if h.IdentityFile, err = ids.file(host.Key); err != nil {
+					return err
+				}
+
+				if h.IdentityFile == "" {
+					comment = append(comment, "viking key: "+host.Key)
+				}
+			}
+
+			h.Comment = strings.Join(comment, "\n")
+			hosts = append(hosts, h)
+		}
+	}
+
+	return sshconfig.Write(vikingCli.Out, hosts)
+}
+
+// sshAlias returns the Host alias of the i-th host of m. m may hold only the
+// selected hosts of the machine, the alias is derived from its hosts in the
+// config so that it does not depend on the selector.
+func sshAlias(cfg *config.Config, m config.Machine, i int) string {
+	if configHosts(cfg, m) == 1 {
+		return m.Name
+	}
+
+	return m.Name + "-" + strconv.Itoa(m.HostIndex(i)+1)
+}
+
+// configHosts returns the number of hosts of m in the config, which differs
+// from len(m.Hosts) when m holds only the selected hosts.
+func configHosts(cfg *config.Config, m config.Machine) int {
+	if full, err := cfg.GetMachineByName(m.Name); err == nil {
+		return len(full.Hosts)
+	}
+
+	return len(m.Hosts)
+}
+
+// proxyJump converts a jump host chain into a ProxyJump value. Machines are
+// reached through their first host, like viking does, referred to by its
+// alias when it is in exported. Other machines are written as USER@HOST:PORT,
+// see jumpSpecs.
+func proxyJump(cfg *config.Config, jump string, exported map[string]bool) string {
+	var chain []string
+	for i, j := range config.SplitJump(jump) {
+		m, err := cfg.GetMachineByName(j)
+		switch {
+		case err != nil || len(m.Hosts) == 0:
+			chain = append(chain, j)
+		case exported[sshAlias(cfg, m, 0)]:
+			chain = append(chain, sshAlias(cfg, m, 0))
+		case i == 0:
+			// The jump hosts of the first machine are not in its Host block.
+			chain = append(chain, jumpSpecs(cfg, j, 0)...)
+		default:
+			host := m.EffectiveHosts()[0]
+			chain = append(chain, host.User+"@"+net.JoinHostPort(host.Address, strconv.Itoa(host.Port)))
+		}
+	}
+
+	return strings.Join(chain, ",")
+}
+
+// identities writes the keys of exported hosts to a directory, each key once.
+type identities struct {
+	cfg   *config.Config
+	dir   string
+	files map[string]string
+	// used holds the file names written, different key names may give the
+	// same file name.
+	used map[string]bool
+}
+
+func newIdentities(cfg *config.Config, dir string) *identities {
+	return &identities{
+		cfg:   cfg,
+		dir:   dir,
+		files: make(map[string]string),
+		used:  make(map[string]bool),
+	}
+}
+
+// file returns the path of the private key named name, writing it first.
+// It returns "" when no directory was given.
+func (ids *identities) file(name string) (string, error) {
+	if ids.dir == "" {
+		return "", nil
+	}
+
+	if file, ok := ids.files[name]; ok {
+		return file, nil
+	}
+
+	base := identityFileName(name)
+	fileName := base
+	for n := 2; ids.used[fileName]; n++ {
+		fileName = base + "-" + strconv.Itoa(n)
+	}
+
+	file, err := writeIdentity(ids.cfg, name, ids.dir, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	ids.files[name] = file
+	ids.used[fileName] = true
+
+	return file, nil
+}
+
+// identityFileName returns the name of the file of the key named name. Key
+// names may contain characters that are not allowed in file names or refer to
+// other directories, such as / or .., which are replaced with underscores.
+func identityFileName(name string) string {
+	file := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	// No hidden files, and neither . nor ..
+	if file == "" || file[0] == '.' {
+		file = "_" + file
+	}
+
+	return file
+}
+
+// writeIdentity writes the private and public key named name to the file
+// fileName of dir and returns the path of the private key.
+func writeIdentity(cfg *config.Config, name, dir, fileName string) (string, error) {
+	key, err := cfg.GetKeyByName(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, name)
+	}
+
+	key, err = cfg.DecryptKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	path, err := filepath.Abs(filepath.Join(dir, fileName))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, []byte(key.Private), 0o600); err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path+".pub", []byte(key.Public), 0o644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,115 @@
+package machine
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/d3witt/viking/ansible"
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+)
+
+func runExportAnsible(vikingCli *command.Cli, selector string, ids *identities) error {
+	machines, err := exportMachines(vikingCli, selector)
+	if err != nil {
+		return err
+	}
+
+	var hosts []ansible.DynamicHost
+	for _, m := range machines {
+		for i, host := range m.EffectiveHosts() {
+			h := ansible.DynamicHost{
+				Name:   sshAlias(vikingCli.Config, m, i),
+				Groups: ansibleGroups(host.Tags),
+				Vars: map[string]any{
+					"ansible_host":   host.Address,
+					"ansible_port":   host.Port,
+					"ansible_user":   host.User,
+					"viking_machine": m.Name,
+				},
+			}
+
+			if configHosts(vikingCli.Config, m) > 1 {
+				h.Groups = append(h.Groups, ansibleGroupName(m.Name))
+			}
+
+			if jumps := jumpSpecs(vikingCli.Config, host.Jump, 0); len(jumps) > 0 {
+				h.Vars["ansible_ssh_common_args"] = "-J " + strings.Join(jumps, ",")
+			}
+
+			if host.Key != "" {
+				file, err := ids.file(host.Key)
+				if err != nil {
+					return err
+				}
+
+				if file != "" {
+					h.Vars["ansible_ssh_private_key_file"] = file
+				} else {
+					h.Vars["viking_key"] = host.Key
+				}
+			}
+
+			hosts = append(hosts, h)
+		}
+	}
+
+	return ansible.WriteDynamic(vikingCli.Out, hosts)
+}
+
+// ansibleGroups returns the groups for tags: the key of tags without value,
+// KEY_VALUE for the others.
+func ansibleGroups(tags map[string]string) []string {
+	groups := make([]string, 0, len(tags))
+	for k, v := range tags {
+		name := k
+		if v != "" {
+			name += "_" + v
+		}
+
+		if name = ansibleGroupName(name); name != ansible.GroupAll && name != ansible.GroupUngrouped {
+			groups = append(groups, name)
+		}
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+// ansibleGroupName replaces the characters Ansible does not allow in group
+// names with underscores.
+func ansibleGroupName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
+
+// jumpSpecs converts a jump host chain into USER@HOST:PORT specs for ssh -J.
+// Machines are reached through their first host, like viking does, and the
+// jump hosts of the first one are followed.
+func jumpSpecs(cfg *config.Config, jump string, depth int) []string {
+	var specs []string
+	for i, j := range config.SplitJump(jump) {
+		m, err := cfg.GetMachineByName(j)
+		if err != nil || len(m.Hosts) == 0 {
+			specs = append(specs, j)
+			continue
+		}
+
+		host := m.EffectiveHosts()[0]
+		if i == 0 && depth < command.MaxJumpDepth {
+			specs = jumpSpecs(cfg, host.Jump, depth+1)
+		}
+
+		specs = append(specs, host.User+"@"+net.JoinHostPort(host.Address, strconv.Itoa(host.Port)))
+	}
+
+	return specs
+}
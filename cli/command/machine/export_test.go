@@ -0,0 +1,66 @@
+package machine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/streams"
+)
+
+func TestExportSSHConfigJump(t *testing.T) {
+	cfg := &config.Config{
+		Machines: map[string]config.Machine{
+			"app": {
+				Hosts: []config.Host{{Address: "10.0.0.1", Port: 22, User: "root"}},
+				Jump:  "bastion",
+			},
+			"db": {
+				Hosts: []config.Host{{Address: "10.0.0.2", Port: 22, User: "root"}},
+				Jump:  "gateway,bastion",
+			},
+			"bastion": {
+				Hosts: []config.Host{{Address: "10.0.0.254", Port: 2222, User: "ops", Jump: "gateway"}},
+			},
+			"gateway": {
+				Hosts: []config.Host{
+					{Address: "gw1.example.com", Port: 22, User: "jump"},
+					{Address: "gw2.example.com", Port: 22, User: "jump"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		// Exported jump machines are referred to by alias.
+		{"", []string{
+			"Host app\n    HostName 10.0.0.1\n    User root\n    ProxyJump bastion\n",
+			"Host db\n    HostName 10.0.0.2\n    User root\n    ProxyJump gateway-1,bastion\n",
+		}},
+		// The jump hosts of the first jump machine are followed.
+		{"app", []string{"ProxyJump jump@gw1.example.com:22,ops@10.0.0.254:2222\n"}},
+		{"db", []string{"ProxyJump jump@gw1.example.com:22,ops@10.0.0.254:2222\n"}},
+		{"app|bastion", []string{"ProxyJump bastion\n", "ProxyJump jump@gw1.example.com:22\n"}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		vikingCli := &command.Cli{Config: cfg, Out: streams.NewOut(&out)}
+
+		if err := runExportSSHConfig(vikingCli, tt.selector, newIdentities(cfg, "")); err != nil {
+			t.Errorf("export %q: %v", tt.selector, err)
+			continue
+		}
+
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("export %q = %q, want it to contain %q", tt.selector, out.String(), want)
+			}
+		}
+	}
+}
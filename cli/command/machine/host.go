@@ -0,0 +1,210 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/cli/command/hostkey"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewHostCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "host",
+		Usage: "Manage the hosts of a machine",
+		Subcommands: []*cli.Command{
+			NewHostAddCmd(vikingCli),
+			NewHostRmCmd(vikingCli),
+		},
+	}
+}
+
+func NewHostAddCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:        "add",
+		Usage:       "Add hosts to a machine",
+		Description: "The user and key default to the ones of the first host of the machine.",
+		Args:        true,
+		ArgsUsage:   "NAME [USER@]HOST[:PORT]...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "user",
+				Aliases: []string{"u"},
+				Usage:   "SSH user name",
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "SSH key name",
+			},
+			&cli.IntFlag{
+				Name:    "port",
+				Aliases: []string{"p"},
+				Value:   22,
+			},
+			&cli.BoolFlag{
+				Name:  "resolve-all",
+				Usage: "Connect to every A and AAAA record of the hostnames, looked up when connecting",
+			},
+			&cli.BoolFlag{
+				Name:  "scan",
+				Usage: "Fetch and pin the host keys of the new hosts",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			name := ctx.Args().First()
+			hosts := ctx.Args().Tail()
+
+			var user, key *string
+			if ctx.IsSet("user") {
+				user = ptr(ctx.String("user"))
+			}
+			if ctx.IsSet("key") {
+				key = ptr(ctx.String("key"))
+			}
+
+			return runHostAdd(vikingCli, name, hosts, user, key, ctx.Int("port"), ctx.Bool("resolve-all"), ctx.Bool("scan"))
+		},
+	}
+}
+
+func NewHostRmCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:        "rm",
+		Usage:       "Remove hosts from a machine",
+		Description: "A machine keeps at least one host, use viking machine rm to remove the machine.",
+		Args:        true,
+		ArgsUsage:   "NAME HOST[:PORT]...",
+		Action: func(ctx *cli.Context) error {
+			name := ctx.Args().First()
+			hosts := ctx.Args().Tail()
+
+			return runHostRm(vikingCli, name, hosts)
+		},
+	}
+}
+
+func runHostAdd(vikingCli *command.Cli, name string, specs []string, user, key *string, port int, resolveAll, scan bool) error {
+	if len(specs) == 0 {
+		return errors.New("at least one host is required")
+	}
+
+	m, err := vikingCli.Config.GetMachineByName(name)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		user = ptr("root")
+		if len(m.Hosts) > 0 {
+			user = &m.Hosts[0].User
+		}
+	}
+
+	if key == nil {
+		key = ptr("")
+		if len(m.Hosts) > 0 {
+			key = &m.Hosts[0].Key
+		}
+	}
+
+	if *key != "" {
+		if _, err := vikingCli.Config.GetKeyByName(*key); err != nil {
+			return err
+		}
+	}
+
+	hosts, err := parseHosts(specs, *user, port, *key, resolveAll)
+	if err != nil {
+		return err
+	}
+
+	if err := checkNewHosts(m, hosts); err != nil {
+		return err
+	}
+
+	if scan {
+		m.Hosts = hosts
+		resolved, err := command.ResolveHosts(m.EffectiveHosts())
+		if err != nil {
+			return err
+		}
+
+		for _, host := range resolved {
+			if err := hostkey.Pin(vikingCli, host, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = vikingCli.Config.UpdateMachine(name, func(m *config.Machine) error {
+		// Hosts may have been added since the machine was read.
+		if err := checkNewHosts(*m, hosts); err != nil {
+			return err
+		}
+
+		m.Hosts = append(m.Hosts, hosts...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "%d host(s) added to machine %s.\n", len(hosts), name)
+
+	return nil
+}
+
+// checkNewHosts checks that hosts are not hosts of m yet and that none of
+// them is given twice.
+func checkNewHosts(m config.Machine, hosts []config.Host) error {
+	for i, host := range hosts {
+		addr := net.JoinHostPort(host.Address, strconv.Itoa(host.Port))
+		if _, err := m.FindHost(addr); err == nil {
+			return fmt.Errorf("machine %s already has host %s", m.Name, addr)
+		}
+
+		for _, other := range hosts[:i] {
+			if strings.EqualFold(host.Address, other.Address) && host.Port == other.Port {
+				return fmt.Errorf("host %s is given more than once", addr)
+			}
+		}
+	}
+
+	return nil
+}
+
+func runHostRm(vikingCli *command.Cli, name string, addrs []string) error {
+	if len(addrs) == 0 {
+		return errors.New("at least one host is required")
+	}
+
+	err := vikingCli.Config.UpdateMachine(name, func(m *config.Machine) error {
+		for _, addr := range addrs {
+			i, err := m.FindHost(addr)
+			if err != nil {
+				return err
+			}
+
+			m.Hosts = append(m.Hosts[:i], m.Hosts[i+1:]...)
+		}
+
+		if len(m.Hosts) == 0 {
+			return fmt.Errorf("%w, use viking machine rm %s to remove the machine", config.ErrMachineHasNoHosts, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "%d host(s) removed from machine %s.\n", len(addrs), name)
+
+	return nil
+}
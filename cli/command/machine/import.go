@@ -0,0 +1,187 @@
+package machine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+func NewImportCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Usage:     "Import machines from an ssh config file or an Ansible inventory",
+		Args:      true,
+		ArgsUsage: "[PATH]",
+		Description: "With --ssh-config, every Host alias without wildcards of the ssh config file at PATH (~/.ssh/config by default) " +
+			"becomes a machine. HostName, User, Port, IdentityFile and ProxyJump are taken over, including the values of wildcard " +
+			"blocks and included files.\n\n" +
+			"With --ansible, every host of the INI or YAML inventory at PATH becomes a machine, tagged with its groups. " +
+			"ansible_host, ansible_port, ansible_user and ansible_ssh_private_key_file are taken over, including group variables.\n\n" +
+			"Identity files are imported as keys, hosts without one use the SSH agent. Machines that already exist are skipped.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "ssh-config",
+				Usage: "Import an OpenSSH client config file",
+			},
+			&cli.BoolFlag{
+				Name:  "ansible",
+				Usage: "Import an Ansible inventory",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() > 1 {
+				return fmt.Errorf("expected at most 1 argument, got %d", ctx.NArg())
+			}
+
+			path := ctx.Args().First()
+
+			switch {
+			case ctx.Bool("ssh-config") && ctx.Bool("ansible"):
+				return errors.New("--ssh-config and --ansible cannot be used together")
+			case ctx.Bool("ssh-config"):
+				return runImportSSHConfig(vikingCli, path)
+			case ctx.Bool("ansible"):
+				if path == "" {
+					return errors.New("inventory path is required")
+				}
+
+				return runImportAnsible(vikingCli, path)
+			default:
+				return errors.New("the format to import is required, use --ssh-config or --ansible")
+			}
+		},
+	}
+}
+
+// importer holds the state shared by the import formats.
+type importer struct {
+	vikingCli *command.Cli
+	home      string
+	localUser string
+	// keys maps identity file paths to the names of their keys.
+	keys map[string]string
+}
+
+func newImporter(vikingCli *command.Cli) (*importer, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return &importer{
+		vikingCli: vikingCli,
+		home:      home,
+		localUser: command.LocalUser(),
+		keys:      make(map[string]string),
+	}, nil
+}
+
+// addMachines adds the machines returned by machine for names, skipping the
+// existing ones and those that cannot be imported.
+func (imp *importer) addMachines(names []string, source string, machine func(name string) (config.Machine, error)) error {
+	added := 0
+	for _, name := range names {
+		if _, err := imp.vikingCli.Config.GetMachineByName(name); err == nil {
+			fmt.Fprintf(imp.vikingCli.Err, "Skipping %s: machine already exists.\n", name)
+			continue
+		}
+
+		m, err := machine(name)
+		if err != nil {
+			fmt.Fprintf(imp.vikingCli.Err, "Skipping %s: %s.\n", name, err)
+			continue
+		}
+
+		if err := imp.vikingCli.Config.AddMachine(m); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(imp.vikingCli.Out, "Machine %s added.\n", name)
+		added++
+	}
+
+	fmt.Fprintf(imp.vikingCli.Out, "%d machine(s) imported from %s.\n", added, source)
+
+	return nil
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func (imp *importer) expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return imp.home + path[1:]
+	}
+
+	return path
+}
+
+// importKey adds the identity file at path as a key, unless a key with the
+// same public key exists, and returns the name of the key.
+func (imp *importer) importKey(path string) (string, error) {
+	if name, ok := imp.keys[path]; ok {
+		return name, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var passphrase string
+	signer, err := ssh.ParsePrivateKey(data)
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, err = command.PromptPassword(imp.vikingCli.In, imp.vikingCli.Err, "Passphrase for "+path)
+		if err != nil {
+			return "", err
+		}
+
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	public := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+
+	for _, key := range imp.vikingCli.Config.ListKeys() {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.Public))
+		if err == nil && bytes.Equal(pub.Marshal(), signer.PublicKey().Marshal()) {
+			imp.keys[path] = key.Name
+			return key.Name, nil
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for i := 2; ; i++ {
+		if _, err := imp.vikingCli.Config.GetKeyByName(name); err != nil {
+			break
+		}
+
+		name = fmt.Sprintf("%s-%d", strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), i)
+	}
+
+	if err := imp.vikingCli.Config.AddKey(config.Key{
+		Name:       name,
+		Private:    string(data),
+		Public:     public,
+		Passphrase: passphrase,
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(imp.vikingCli.Out, "Key %s added.\n", name)
+	imp.keys[path] = name
+
+	return name, nil
+}
@@ -0,0 +1,110 @@
+package machine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d3witt/viking/ansible"
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+)
+
+func runImportAnsible(vikingCli *command.Cli, path string) error {
+	base, err := newImporter(vikingCli)
+	if err != nil {
+		return err
+	}
+
+	inv, err := ansible.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	imp := ansibleImport{importer: base, inventory: inv}
+
+	return imp.addMachines(inv.Hosts, path, imp.machine)
+}
+
+type ansibleImport struct {
+	*importer
+	inventory *ansible.Inventory
+}
+
+// machine returns the machine for the inventory host name, tagged with the
+// groups of the host.
+func (imp *ansibleImport) machine(name string) (config.Machine, error) {
+	vars := imp.inventory.HostVars(name)
+
+	addr := ansibleVar(vars, "ansible_host", "ansible_ssh_host")
+	if addr == "" {
+		addr = name
+	}
+
+	if err := config.ValidateAddress(addr); err != nil {
+		return config.Machine{}, err
+	}
+
+	port := 22
+	if p := ansibleVar(vars, "ansible_port", "ansible_ssh_port"); p != "" {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+			return config.Machine{}, fmt.Errorf("invalid port %q", p)
+		}
+	}
+
+	remoteUser := ansibleVar(vars, "ansible_user", "ansible_ssh_user")
+	if remoteUser == "" {
+		remoteUser = imp.localUser
+	}
+
+	var key string
+	if file := ansibleVar(vars, "ansible_ssh_private_key_file", "ansible_private_key_file"); file != "" {
+		var err error
+		if key, err = imp.importKey(imp.expandHome(file)); err != nil {
+			fmt.Fprintf(imp.vikingCli.Err, "%s: %s.\n", name, err)
+		}
+	}
+
+	var tags map[string]string
+	for _, group := range imp.inventory.HostGroups(name) {
+		if group == ansible.GroupAll || group == ansible.GroupUngrouped {
+			continue
+		}
+
+		if _, _, err := config.ParseTag(group); err != nil {
+			fmt.Fprintf(imp.vikingCli.Err, "%s: group %s cannot be used as tag, skipped.\n", name, group)
+			continue
+		}
+
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[group] = ""
+	}
+
+	return config.Machine{
+		Name:      name,
+		CreatedAt: time.Now(),
+		Tags:      tags,
+		Hosts: []config.Host{{
+			Address: addr,
+			Port:    port,
+			User:    remoteUser,
+			Key:     key,
+		}},
+	}, nil
+}
+
+// ansibleVar returns the first of the named variables that is set. Values
+// using Jinja templates cannot be evaluated and are ignored.
+func ansibleVar(vars map[string]string, names ...string) string {
+	for _, name := range names {
+		if v := vars[name]; v != "" && !strings.Contains(v, "{{") {
+			return v
+		}
+	}
+
+	return ""
+}
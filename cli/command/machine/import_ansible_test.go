@@ -0,0 +1,105 @@
+package machine
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/d3witt/viking/ansible"
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/streams"
+)
+
+func TestAnsibleImportMachine(t *testing.T) {
+	inv, err := ansible.ParseINI(strings.NewReader(`
+plain
+
+[web]
+web1 ansible_host=10.0.0.1 ansible_port=2222 ansible_user=deploy
+web2 ansible_host="{{ lookup('env', 'IP') }}" ansible_ssh_host=10.0.0.2
+
+[web:vars]
+ansible_port=2022
+
+[legacy]
+old ansible_ssh_host=10.0.0.3 ansible_ssh_port=2200 ansible_ssh_user=ops
+
+[prod:children]
+web
+
+[odd*group]
+web2
+
+[broken]
+badport ansible_port=ssh
+badaddr ansible_host=-oProxyCommand=x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errOut bytes.Buffer
+	imp := &ansibleImport{
+		importer: &importer{
+			vikingCli: &command.Cli{Err: streams.NewOut(&errOut)},
+			home:      t.TempDir(),
+			localUser: "me",
+		},
+		inventory: inv,
+	}
+
+	tests := []struct {
+		name string
+		host config.Host
+		tags map[string]string
+	}{
+		{
+			name: "plain",
+			host: config.Host{Address: "plain", Port: 22, User: "me"},
+		},
+		{
+			name: "web1",
+			host: config.Host{Address: "10.0.0.1", Port: 2222, User: "deploy"},
+			tags: map[string]string{"prod": "", "web": ""},
+		},
+		// Templates cannot be evaluated, the next variable is used.
+		{
+			name: "web2",
+			host: config.Host{Address: "10.0.0.2", Port: 2022, User: "me"},
+			tags: map[string]string{"prod": "", "web": ""},
+		},
+		{
+			name: "old",
+			host: config.Host{Address: "10.0.0.3", Port: 2200, User: "ops"},
+			tags: map[string]string{"legacy": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		m, err := imp.machine(tt.name)
+		if err != nil {
+			t.Errorf("machine(%s): %v", tt.name, err)
+			continue
+		}
+
+		if m.Name != tt.name || !reflect.DeepEqual(m.Hosts, []config.Host{tt.host}) {
+			t.Errorf("machine(%s) = %s %+v, want host %+v", tt.name, m.Name, m.Hosts, tt.host)
+		}
+
+		if !reflect.DeepEqual(m.Tags, tt.tags) {
+			t.Errorf("machine(%s) tags = %v, want %v", tt.name, m.Tags, tt.tags)
+		}
+	}
+
+	if got := errOut.String(); !strings.Contains(got, "web2: group odd*group cannot be used as tag") {
+		t.Errorf("error output = %q, want the skipped group", got)
+	}
+
+	for _, name := range []string{"badport", "badaddr"} {
+		if _, err := imp.machine(name); err == nil {
+			t.Errorf("machine(%s) succeeded", name)
+		}
+	}
+}
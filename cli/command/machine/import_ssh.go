@@ -0,0 +1,203 @@
+package machine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/d3witt/viking/sshconfig"
+)
+
+func runImportSSHConfig(vikingCli *command.Cli, path string) error {
+	base, err := newImporter(vikingCli)
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		path = filepath.Join(base.home, ".ssh", "config")
+	}
+
+	sshConfig, err := sshconfig.ParseFile(path)
+	if err != nil {
+		return err
+	}
+
+	aliases := sshConfig.Hosts()
+
+	imp := sshConfigImport{
+		importer: base,
+		config:   sshConfig,
+		aliases:  make(map[string]bool, len(aliases)),
+	}
+	for _, alias := range aliases {
+		imp.aliases[alias] = true
+	}
+
+	return imp.addMachines(aliases, path, imp.machine)
+}
+
+type sshConfigImport struct {
+	*importer
+	config *sshconfig.Config
+	// aliases are the hosts of the ssh config, they become machines.
+	aliases map[string]bool
+}
+
+// machine returns the machine for the host alias.
+func (imp *sshConfigImport) machine(alias string) (config.Machine, error) {
+	addr := imp.expand(imp.config.Get(alias, "HostName"), alias, "")
+	if addr == "" {
+		addr = alias
+	}
+
+	if err := config.ValidateAddress(addr); err != nil {
+		return config.Machine{}, err
+	}
+
+	port := 22
+	if p := imp.config.Get(alias, "Port"); p != "" {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+			return config.Machine{}, fmt.Errorf("invalid port %q", p)
+		}
+	}
+
+	remoteUser := imp.config.Get(alias, "User")
+	if remoteUser == "" {
+		remoteUser = imp.localUser
+	}
+
+	if imp.config.Get(alias, "ProxyCommand") != "" {
+		fmt.Fprintf(imp.vikingCli.Err, "%s: ProxyCommand is not supported, ignored.\n", alias)
+	}
+
+	jump, jumpKey, err := imp.jump(alias, imp.config.Get(alias, "ProxyJump"))
+	if err != nil {
+		return config.Machine{}, err
+	}
+
+	key := imp.identity(alias, addr, remoteUser)
+	if jumpKey == key {
+		jumpKey = ""
+	}
+
+	return config.Machine{
+		Name:      alias,
+		CreatedAt: time.Now(),
+		Jump:      jump,
+		Hosts: []config.Host{{
+			Address: addr,
+			Port:    port,
+			User:    remoteUser,
+			Key:     key,
+			JumpKey: jumpKey,
+		}},
+	}, nil
+}
+
+// identity imports the first IdentityFile of alias that can be read and
+// returns the name of its key, "" if there is none.
+func (imp *sshConfigImport) identity(alias, addr, remoteUser string) string {
+	for _, file := range imp.config.GetAll(alias, "IdentityFile") {
+		if strings.EqualFold(file, "none") {
+			continue
+		}
+
+		key, err := imp.importKey(imp.expand(file, addr, remoteUser))
+		if err != nil {
+			fmt.Fprintf(imp.vikingCli.Err, "%s: %s.\n", alias, err)
+			continue
+		}
+
+		return key
+	}
+
+	return ""
+}
+
+// jump converts the ProxyJump value of alias into a jump host chain. Aliases
+// of the ssh config refer to the machines imported for them. Aliases with
+// another user or port become specs, logging in with the key of their
+// IdentityFile, which is returned as jump key.
+func (imp *sshConfigImport) jump(alias, proxyJump string) (string, string, error) {
+	if proxyJump == "" || strings.EqualFold(proxyJump, "none") {
+		return "", "", nil
+	}
+
+	var chain []string
+	var jumpKey string
+	for _, j := range strings.Split(proxyJump, ",") {
+		j = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(j), "ssh://"), "/")
+
+		if imp.aliases[j] {
+			chain = append(chain, j)
+			continue
+		}
+
+		user, host, port, err := command.ParseHostSpec(j, "", 0)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid ProxyJump %q: %w", j, err)
+		}
+
+		// An alias with another user or port, use its real address and key.
+		if jumpAlias := host; imp.aliases[jumpAlias] {
+			if hostName := imp.expand(imp.config.Get(jumpAlias, "HostName"), jumpAlias, ""); hostName != "" {
+				host = hostName
+			}
+			if user == "" {
+				user = imp.config.Get(jumpAlias, "User")
+			}
+			if port == 0 {
+				port, _ = strconv.Atoi(imp.config.Get(jumpAlias, "Port"))
+			}
+
+			remoteUser := user
+			if remoteUser == "" {
+				remoteUser = imp.localUser
+			}
+
+			// All specs of a chain log in with the same key.
+			switch key := imp.identity(jumpAlias, host, remoteUser); {
+			case key == "" || key == jumpKey:
+			case jumpKey == "":
+				jumpKey = key
+			default:
+				fmt.Fprintf(imp.vikingCli.Err, "%s: the jump hosts use different keys, %s is used for all of them.\n", alias, jumpKey)
+			}
+		}
+
+		spec := host
+		if port != 0 {
+			spec = command.HostAddr(config.Host{Address: host, Port: port})
+		}
+		if user != "" {
+			spec = user + "@" + spec
+		}
+
+		chain = append(chain, spec)
+	}
+
+	return strings.Join(chain, ","), jumpKey, nil
+}
+
+// expand replaces the tokens of ssh config values and a leading ~.
+func (imp *sshConfigImport) expand(value, host, remoteUser string) string {
+	value = imp.expandHome(value)
+
+	if !strings.Contains(value, "%") {
+		return value
+	}
+
+	return strings.NewReplacer(
+		"%%", "%",
+		"%d", imp.home,
+		"%h", host,
+		"%r", remoteUser,
+		"%u", imp.localUser,
+	).Replace(value)
+}
@@ -0,0 +1,130 @@
+package machine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/sshconfig"
+	"github.com/d3witt/viking/streams"
+)
+
+func TestSSHConfigImportJump(t *testing.T) {
+	home := t.TempDir()
+	path := filepath.Join(home, "config")
+
+	err := os.WriteFile(path, []byte(`
+Host app
+    HostName 10.0.0.1
+    ProxyJump bastion
+
+Host web
+    HostName 10.0.0.2
+    ProxyJump ops@bastion
+
+Host bastion
+    HostName 10.0.0.254
+    User jump
+    Port 2222
+    ProxyJump gateway
+    IdentityFile ~/.ssh/%r
+
+Host gateway
+    HostName %h.example.com
+    IdentityFile ~/.ssh/gateway
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := sshconfig.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errOut bytes.Buffer
+	imp := &sshConfigImport{
+		importer: &importer{
+			vikingCli: &command.Cli{Err: streams.NewOut(&errOut)},
+			home:      home,
+			localUser: "me",
+			// The identity files are known, nothing is read.
+			keys: map[string]string{
+				filepath.Join(home, ".ssh", "jump"):    "jump",
+				filepath.Join(home, ".ssh", "ops"):     "ops",
+				filepath.Join(home, ".ssh", "gateway"): "gateway",
+			},
+		},
+		config:  cfg,
+		aliases: map[string]bool{"app": true, "web": true, "bastion": true, "gateway": true},
+	}
+
+	tests := []struct {
+		proxyJump string
+		want      string
+		wantKey   string
+	}{
+		{"", "", ""},
+		{"none", "", ""},
+		{"NONE", "", ""},
+		// Aliases refer to their machines, which keep their own jump hosts
+		// and keys.
+		{"bastion", "bastion", ""},
+		{"gateway,bastion", "gateway,bastion", ""},
+		{"ssh://bastion/", "bastion", ""},
+		// Hosts that are not aliases are kept, the local user is used when
+		// none is given.
+		{"10.0.0.9", "10.0.0.9", ""},
+		{"ops@10.0.0.9:2200", "ops@10.0.0.9:2200", ""},
+		{"ops@10.0.0.9:22", "ops@10.0.0.9", ""},
+		{"gateway, admin@[fd00::1]:2200", "gateway,admin@[fd00::1]:2200", ""},
+		// An alias with another user or port uses the address and the key of
+		// the alias.
+		{"ops@bastion", "ops@10.0.0.254:2222", "ops"},
+		{"bastion:2200", "jump@10.0.0.254:2200", "jump"},
+		{"ops@gateway", "ops@gateway.example.com", "gateway"},
+		{"gateway,bastion:2200", "gateway,jump@10.0.0.254:2200", "jump"},
+		// The first key is used for all specs.
+		{"ops@gateway,bastion:2200", "ops@gateway.example.com,jump@10.0.0.254:2200", "gateway"},
+	}
+
+	for _, tt := range tests {
+		got, key, err := imp.jump("app", tt.proxyJump)
+		if err != nil {
+			t.Errorf("jump(%q): %v", tt.proxyJump, err)
+			continue
+		}
+
+		if got != tt.want || key != tt.wantKey {
+			t.Errorf("jump(%q) = %q, %q, want %q, %q", tt.proxyJump, got, key, tt.want, tt.wantKey)
+		}
+	}
+
+	if got := errOut.String(); got != "app: the jump hosts use different keys, gateway is used for all of them.\n" {
+		t.Errorf("error output = %q, want the key of the first jump host", got)
+	}
+
+	if _, _, err := imp.jump("app", "ops@10.0.0.9:port"); err == nil {
+		t.Error("jump with an invalid port succeeded")
+	}
+
+	// The key of a jump alias is the jump key of the machine.
+	m, err := imp.machine("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Jump != "bastion" || m.Hosts[0].JumpKey != "" {
+		t.Errorf("machine(app) jump = %q with key %q, want bastion with its own key", m.Jump, m.Hosts[0].JumpKey)
+	}
+
+	if m, err = imp.machine("web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Jump != "ops@10.0.0.254:2222" || m.Hosts[0].JumpKey != "ops" {
+		t.Errorf("machine(web) jump = %q with key %q, want ops@10.0.0.254:2222 with key ops", m.Jump, m.Hosts[0].JumpKey)
+	}
+}
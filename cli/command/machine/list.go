@@ -3,53 +3,180 @@ package machine
 import (
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
 	"github.com/dustin/go-humanize"
 	"github.com/urfave/cli/v2"
 )
 
+const selectorHelp = `SELECTOR picks hosts by machine name and tags:
+
+   NAME       machine name or tag key, globs allowed (db-*)
+   KEY=VALUE  tag with the given value, globs allowed (region=eu-*)
+   !TERM      negation
+   A,B        both A and B match
+   A|B        A or B matches
+
+A machine name always selects exactly that machine.`
+
 func NewListCmd(vikingCli *command.Cli) *cli.Command {
 	return &cli.Command{
-		Name:  "ls",
-		Usage: "List machines",
+		Name:        "ls",
+		Usage:       "List machines",
+		Description: selectorHelp,
+		Args:        true,
+		ArgsUsage:   "[SELECTOR]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   command.FormatUsage,
+			},
+		},
 		Action: func(ctx *cli.Context) error {
-			return listMachines(vikingCli)
+			selector := ctx.Args().First()
+			format := ctx.String("format")
+
+			return listMachines(vikingCli, selector, format)
 		},
 	}
 }
 
-func listMachines(vikingCli *command.Cli) error {
-	machines := vikingCli.Config.ListMachines()
+type machineView struct {
+	Name      string            `json:"name" yaml:"name"`
+	Hosts     []hostView        `json:"hosts" yaml:"hosts"`
+	Jump      string            `json:"jump,omitempty" yaml:"jump,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt time.Time         `json:"created_at" yaml:"created_at"`
+}
+
+type hostView struct {
+	Address string `json:"address" yaml:"address"`
+	// IP is the same as Address. It is kept for scripts and templates
+	// written when only IP addresses were supported.
+	IP         string            `json:"ip" yaml:"ip"`
+	Port       int               `json:"port" yaml:"port"`
+	User       string            `json:"user" yaml:"user"`
+	Key        string            `json:"key,omitempty" yaml:"key,omitempty"`
+	Jump       string            `json:"jump,omitempty" yaml:"jump,omitempty"`
+	JumpKey    string            `json:"jump_key,omitempty" yaml:"jump_key,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	ResolveAll bool              `json:"resolve_all,omitempty" yaml:"resolve_all,omitempty"`
+}
+
+func newMachineView(m config.Machine) machineView {
+	view := machineView{
+		Name:      m.Name,
+		Hosts:     make([]hostView, len(m.Hosts)),
+		Jump:      m.Jump,
+		Tags:      m.Tags,
+		CreatedAt: m.CreatedAt,
+	}
+
+	for i, host := range m.Hosts {
+		view.Hosts[i] = hostView{
+			Address:    host.Address,
+			IP:         host.Address,
+			Port:       host.Port,
+			User:       host.User,
+			Key:        host.Key,
+			Jump:       host.Jump,
+			JumpKey:    host.JumpKey,
+			Tags:       host.Tags,
+			ResolveAll: host.ResolveAll,
+		}
+	}
+
+	return view
+}
+
+func listMachines(vikingCli *command.Cli, selector, format string) error {
+	var machines []config.Machine
+	if selector == "" {
+		machines = vikingCli.Config.ListMachines()
+	} else {
+		var err error
+		machines, err = vikingCli.Config.SelectMachines(selector)
+		if err != nil {
+			return err
+		}
+	}
 
 	sort.Slice(machines, func(i, j int) bool {
 		return machines[i].CreatedAt.After(machines[j].CreatedAt)
 	})
 
-	data := [][]string{}
-
-	for _, machine := range machines {
-		firstHost := machine.Hosts[0]
-		data = append(data, []string{
-			machine.Name,
-			firstHost.IP.String(),
-			strconv.Itoa(firstHost.Port),
-			firstHost.Key,
-			humanize.Time(machine.CreatedAt),
-		})
-
-		for _, host := range machine.Hosts[1:] {
-			data = append(data, []string{
-				" ",
-				host.IP.String(),
+	listing := command.Listing{
+		Footer: command.ProfileFooter(vikingCli.Config),
+		Items:  make([]machineView, len(machines)),
+		Header: []string{
+			"NAME",
+			"ADDRESS",
+			"PORT",
+			"USER",
+			"KEY",
+			"CREATED",
+			"TAGS",
+		},
+		// The csv columns keep the names they had when only IP addresses
+		// were supported.
+		CSVHeader: []string{
+			"NAME",
+			"IP",
+			"PORT",
+			"USER",
+			"KEY",
+			"CREATED",
+			"TAGS",
+		},
+		CSVRows: [][]string{},
+	}
+
+	for i, machine := range machines {
+		listing.Items.([]machineView)[i] = newMachineView(machine)
+
+		// Older versions allowed machines without hosts, list them so they
+		// can be fixed with viking machine host add.
+		if len(machine.Hosts) == 0 {
+			row := []string{machine.Name, "", "", "", "", machine.CreatedAt.Format(time.RFC3339), config.FormatTags(machine.Tags)}
+			listing.CSVRows = append(listing.CSVRows, row)
+			listing.Rows = append(listing.Rows, []string{machine.Name, "", "", "", "", humanize.Time(machine.CreatedAt), row[6]})
+		}
+
+		for j, host := range machine.EffectiveHosts() {
+			row := []string{
+				machine.Name,
+				listAddress(host),
 				strconv.Itoa(host.Port),
+				host.User,
 				host.Key,
-				" ",
-			})
+				machine.CreatedAt.Format(time.RFC3339),
+				config.FormatTags(host.Tags),
+			}
+			listing.CSVRows = append(listing.CSVRows, row)
+
+			if j == 0 {
+				row = append([]string{}, row...)
+				row[5] = humanize.Time(machine.CreatedAt)
+			} else {
+				row = []string{" ", row[1], row[2], row[3], row[4], " ", row[6]}
+			}
+			listing.Rows = append(listing.Rows, row)
 		}
 	}
 
-	command.PrintTable(vikingCli.Out, data)
+	return command.PrintListing(vikingCli.Out, format, listing)
+}
+
+// listAddress returns the address of host as listed, marking hosts that are
+// resolved into all their addresses.
+func listAddress(host config.Host) string {
+	if host.ResolveAll {
+		return host.Address + " (all)"
+	}
 
-	return nil
+	return host.Address
 }
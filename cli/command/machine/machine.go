@@ -13,8 +13,15 @@ func NewCmd(vikingCli *command.Cli) *cli.Command {
 			NewAddCmd(vikingCli),
 			NewListCmd(vikingCli),
 			NewRmCmd(vikingCli),
+			NewEditCmd(vikingCli),
+			NewRenameCmd(vikingCli),
+			NewHostCmd(vikingCli),
+			NewImportCmd(vikingCli),
+			NewExportCmd(vikingCli),
 			NewExecuteCmd(vikingCli),
 			NewCopyCmd(vikingCli),
+			NewTagCmd(vikingCli),
+			NewUntagCmd(vikingCli),
 		},
 	}
 }
@@ -0,0 +1,40 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewRenameCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:        "rename",
+		Usage:       "Rename a machine",
+		Description: "Jump hosts referring to the machine are updated.",
+		Args:        true,
+		ArgsUsage:   "NAME NEW_NAME",
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 2 {
+				return fmt.Errorf("expected 2 arguments, got %d", ctx.NArg())
+			}
+
+			return runRename(vikingCli, ctx.Args().Get(0), ctx.Args().Get(1))
+		},
+	}
+}
+
+func runRename(vikingCli *command.Cli, name, newName string) error {
+	if newName == "" {
+		return errors.New("new name must not be empty")
+	}
+
+	if err := vikingCli.Config.RenameMachine(name, newName); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Machine %s renamed to %s.\n", name, newName)
+
+	return nil
+}
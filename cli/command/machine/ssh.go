@@ -0,0 +1,146 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewSSHCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "ssh",
+		Usage:     "Open a shell on a machine",
+		ArgsUsage: "MACHINE [HOST-INDEX|IP[:PORT]]",
+		Description: "Opens a login shell on a host of the machine. When the machine has several hosts and none is given, " +
+			"viking asks which one to use. Hosts are numbered from 1 in the order of viking machine ls.\n\n" +
+			"TERM is passed to the host. Use --env to pass other variables, the host must accept them (AcceptEnv).\n\n" +
+			"Type ~. at the beginning of a line to drop the connection, ~? for other escape sequences.",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Pass the environment variable `NAME`, NAME=VALUE or a pattern such as LC_*",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() < 1 || ctx.NArg() > 2 {
+				return fmt.Errorf("expected 1 or 2 arguments, got %d", ctx.NArg())
+			}
+
+			return runSSH(ctx.Context, vikingCli, ctx.Args().Get(0), ctx.Args().Get(1), ctx.StringSlice("env"))
+		},
+	}
+}
+
+func runSSH(ctx context.Context, vikingCli *command.Cli, machine, host string, env []string) error {
+	if !vikingCli.In.IsTerminal() {
+		return errors.New("cannot open a shell: input is not a terminal")
+	}
+
+	m, err := vikingCli.Config.GetMachineByName(machine)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, machine)
+	}
+
+	h, err := selectHost(vikingCli, m, host)
+	if err != nil {
+		return err
+	}
+
+	exec, err := vikingCli.HostExecutor(h)
+	if err != nil {
+		return err
+	}
+	defer exec.Close()
+
+	for _, kv := range environ(env) {
+		exec.Setenv(kv[0], kv[1])
+	}
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	return executeTTY(ctx, vikingCli, exec, "")
+}
+
+// selectHost returns the host of m given as 1-based index or address. When
+// arg is empty and m has several hosts, the user is asked to pick one.
+func selectHost(vikingCli *command.Cli, m config.Machine, arg string) (config.Host, error) {
+	hosts := m.EffectiveHosts()
+	if len(hosts) == 0 {
+		return config.Host{}, fmt.Errorf("machine %s has no hosts", m.Name)
+	}
+
+	if arg == "" {
+		if len(hosts) == 1 {
+			return hosts[0], nil
+		}
+
+		if !vikingCli.In.IsTerminal() {
+			return config.Host{}, fmt.Errorf("machine %s has %d hosts, pick one by index or address", m.Name, len(hosts))
+		}
+
+		for i, host := range hosts {
+			fmt.Fprintf(vikingCli.Err, "%d) %s", i+1, command.HostAddr(host))
+			if tags := config.FormatTags(host.Tags); tags != "" {
+				fmt.Fprintf(vikingCli.Err, " %s", tags)
+			}
+			fmt.Fprintln(vikingCli.Err)
+		}
+
+		answer, err := command.Prompt(vikingCli.In, vikingCli.Err, "Host", "1")
+		if err != nil {
+			return config.Host{}, err
+		}
+
+		arg = answer
+		if arg == "" {
+			arg = "1"
+		}
+	}
+
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(hosts) {
+			return config.Host{}, fmt.Errorf("invalid host index %d, machine %s has %d hosts", n, m.Name, len(hosts))
+		}
+
+		return hosts[n-1], nil
+	}
+
+	i, err := m.FindHost(arg)
+	if err != nil {
+		return config.Host{}, err
+	}
+
+	return hosts[i], nil
+}
+
+// environ returns the variables to pass for the given names, NAME=VALUE pairs
+// or patterns. Names that are not set locally are skipped.
+func environ(env []string) [][2]string {
+	var vars [][2]string
+
+	for _, e := range env {
+		if name, value, ok := strings.Cut(e, "="); ok {
+			vars = append(vars, [2]string{name, value})
+			continue
+		}
+
+		for _, kv := range os.Environ() {
+			name, value, _ := strings.Cut(kv, "=")
+			if ok, _ := path.Match(e, name); ok {
+				vars = append(vars, [2]string{name, value})
+			}
+		}
+	}
+
+	return vars
+}
@@ -0,0 +1,139 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewTagCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "tag",
+		Usage:     "Add or update machine tags",
+		Args:      true,
+		ArgsUsage: "NAME KEY[=VALUE]...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Tag only the host with this address (HOST or HOST:PORT)",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			name := ctx.Args().First()
+			tags := ctx.Args().Tail()
+			host := ctx.String("host")
+
+			return runTag(vikingCli, name, host, tags)
+		},
+	}
+}
+
+func NewUntagCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "untag",
+		Usage:     "Remove machine tags",
+		Args:      true,
+		ArgsUsage: "NAME KEY...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Untag only the host with this address (HOST or HOST:PORT)",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			name := ctx.Args().First()
+			keys := ctx.Args().Tail()
+			host := ctx.String("host")
+
+			return runUntag(vikingCli, name, host, keys)
+		},
+	}
+}
+
+func runTag(vikingCli *command.Cli, name, host string, tags []string) error {
+	if len(tags) == 0 {
+		return errors.New("at least one tag is required")
+	}
+
+	parsed := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		key, value, err := config.ParseTag(tag)
+		if err != nil {
+			return err
+		}
+
+		parsed[key] = value
+	}
+
+	err := vikingCli.Config.UpdateMachine(name, func(m *config.Machine) error {
+		target, err := machineTags(m, host)
+		if err != nil {
+			return err
+		}
+
+		if *target == nil {
+			*target = make(map[string]string, len(parsed))
+		}
+
+		for k, v := range parsed {
+			(*target)[k] = v
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Machine %s tagged.\n", name)
+
+	return nil
+}
+
+func runUntag(vikingCli *command.Cli, name, host string, keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("at least one tag is required")
+	}
+
+	err := vikingCli.Config.UpdateMachine(name, func(m *config.Machine) error {
+		target, err := machineTags(m, host)
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			delete(*target, k)
+		}
+
+		if len(*target) == 0 {
+			*target = nil
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Machine %s untagged.\n", name)
+
+	return nil
+}
+
+// machineTags returns the tags of the machine, or of one of its hosts when
+// host is set.
+func machineTags(m *config.Machine, host string) (*map[string]string, error) {
+	if host == "" {
+		return &m.Tags, nil
+	}
+
+	i, err := m.FindHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m.Hosts[i].Tags, nil
+}
@@ -0,0 +1,101 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/sshexec"
+	"github.com/urfave/cli/v2"
+)
+
+func NewTunnelCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "tunnel",
+		Usage:     "Forward ports through a machine",
+		ArgsUsage: "MACHINE",
+		Description: "Forwards run until viking is interrupted. The connection is restored when it drops.\n\n" +
+			"Examples:\n" +
+			"  viking tunnel -L 5432:localhost:5432 db       # local port 5432 to port 5432 on the machine\n" +
+			"  viking tunnel -R 8080:localhost:3000 web      # port 8080 on the machine to local port 3000\n" +
+			"  viking tunnel -D 1080 bastion                 # SOCKS5 proxy on local port 1080",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "L",
+				Usage: "Forward a local port to a host reachable from the machine, as `[BIND_ADDRESS:]PORT:HOST:HOSTPORT`",
+			},
+			&cli.StringSliceFlag{
+				Name:  "R",
+				Usage: "Forward a port of the machine to a host reachable locally, as `[BIND_ADDRESS:]PORT:HOST:HOSTPORT`",
+			},
+			&cli.StringSliceFlag{
+				Name:  "D",
+				Usage: "Run a local SOCKS5 proxy connecting through the machine, as `[BIND_ADDRESS:]PORT`",
+			},
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "Host of the machine to connect to, as `HOST-INDEX` or IP[:PORT]. Asked for when the machine has several hosts",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			var forwards []sshexec.Forward
+			for kind, specs := range [][]string{
+				sshexec.ForwardLocal:   ctx.StringSlice("L"),
+				sshexec.ForwardRemote:  ctx.StringSlice("R"),
+				sshexec.ForwardDynamic: ctx.StringSlice("D"),
+			} {
+				for _, spec := range specs {
+					f, err := sshexec.ParseForward(sshexec.ForwardKind(kind), spec)
+					if err != nil {
+						return err
+					}
+
+					forwards = append(forwards, f)
+				}
+			}
+
+			if len(forwards) == 0 {
+				return errors.New("at least one of -L, -R or -D is required")
+			}
+
+			return runTunnel(ctx.Context, vikingCli, ctx.Args().First(), ctx.String("host"), forwards)
+		},
+	}
+}
+
+func runTunnel(ctx context.Context, vikingCli *command.Cli, machine, addr string, forwards []sshexec.Forward) error {
+	m, err := vikingCli.Config.GetMachineByName(machine)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, machine)
+	}
+
+	host, err := selectHost(vikingCli, m, addr)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := vikingCli.HostClientConfig(host)
+	if err != nil {
+		return err
+	}
+	defer cfg.Jump.Close()
+
+	tunnel := sshexec.NewTunnel(cfg, forwards...)
+	tunnel.SetLogger(slog.New(command.NewCmdLogHandler(vikingCli.Err, nil)))
+
+	for _, f := range forwards {
+		fmt.Fprintf(vikingCli.Out, "Forwarding %s %s through %s.\n", f.Kind, f, cfg.Addr())
+	}
+	fmt.Fprintln(vikingCli.Out, "Press Ctrl-C to stop.")
+
+	ctx, stop := command.SignalContext(ctx)
+	defer stop()
+
+	return tunnel.Run(ctx)
+}
@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewCreateCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "create",
+		Usage:     "Create an empty profile",
+		Args:      true,
+		ArgsUsage: "NAME",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "use",
+				Usage: "Make the new profile the current one",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			return runCreate(vikingCli, ctx.Args().First(), ctx.Bool("use"))
+		},
+	}
+}
+
+func runCreate(vikingCli *command.Cli, name string, use bool) error {
+	if err := config.CreateProfile(name); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Profile %s created.\n", name)
+
+	if use {
+		return runUse(vikingCli, name)
+	}
+
+	return nil
+}
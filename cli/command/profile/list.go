@@ -0,0 +1,82 @@
+package profile
+
+import (
+	"strconv"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewListCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:  "ls",
+		Usage: "List profiles",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "table",
+				Usage:   command.FormatUsage,
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			format := ctx.String("format")
+
+			return listProfiles(vikingCli, format)
+		},
+	}
+}
+
+type profileView struct {
+	Name     string `json:"name" yaml:"name"`
+	Active   bool   `json:"active" yaml:"active"`
+	Machines int    `json:"machines" yaml:"machines"`
+	Keys     int    `json:"keys" yaml:"keys"`
+}
+
+func listProfiles(vikingCli *command.Cli, format string) error {
+	names, err := config.ListProfiles()
+	if err != nil {
+		return err
+	}
+
+	listing := command.Listing{
+		Items: make([]profileView, len(names)),
+		Header: []string{
+			"NAME",
+			"ACTIVE",
+			"MACHINES",
+			"KEYS",
+		},
+	}
+
+	for i, name := range names {
+		cfg, err := config.ParseProfileConfig(name)
+		if err != nil {
+			return err
+		}
+
+		view := profileView{
+			Name:     name,
+			Active:   name == vikingCli.Config.ProfileName(),
+			Machines: len(cfg.Machines),
+			Keys:     len(cfg.Keys),
+		}
+		listing.Items.([]profileView)[i] = view
+
+		active := ""
+		if view.Active {
+			active = "*"
+		}
+
+		listing.Rows = append(listing.Rows, []string{
+			view.Name,
+			active,
+			strconv.Itoa(view.Machines),
+			strconv.Itoa(view.Keys),
+		})
+	}
+
+	return command.PrintListing(vikingCli.Out, format, listing)
+}
@@ -0,0 +1,22 @@
+package profile
+
+import (
+	"github.com/d3witt/viking/cli/command"
+	"github.com/urfave/cli/v2"
+)
+
+func NewCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:    "context",
+		Aliases: []string{"profile"},
+		Usage:   "Manage profiles, each with its own machines and keys",
+		Description: "Every profile is stored in its own file in the config directory. The current profile is used " +
+			"unless another one is given with --profile or the VIKING_PROFILE env variable.",
+		Subcommands: []*cli.Command{
+			NewListCmd(vikingCli),
+			NewUseCmd(vikingCli),
+			NewCreateCmd(vikingCli),
+			NewRmCmd(vikingCli),
+		},
+	}
+}
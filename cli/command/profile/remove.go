@@ -0,0 +1,67 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewRmCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "rm",
+		Usage:     "Remove a profile with its machines and keys",
+		Args:      true,
+		ArgsUsage: "NAME",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "force",
+				Aliases: []string{"f"},
+				Usage:   "Do not ask for confirmation",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			return runRemove(vikingCli, ctx.Args().First(), ctx.Bool("force"))
+		},
+	}
+}
+
+func runRemove(vikingCli *command.Cli, name string, force bool) error {
+	if name == config.DefaultProfileName {
+		return config.ErrDefaultProfile
+	}
+
+	if name == vikingCli.Config.ProfileName() {
+		return fmt.Errorf("%w: %s is used by this command", config.ErrProfileInUse, name)
+	}
+
+	cfg, err := config.ParseProfileConfig(name)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		ok, err := command.PromptForConfirmation(vikingCli.In, vikingCli.Out,
+			fmt.Sprintf("Remove profile %s with %d machine(s) and %d key(s)?", name, len(cfg.Machines), len(cfg.Keys)))
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+	}
+
+	if err := config.RemoveProfile(name); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Profile %s removed.\n", name)
+
+	return nil
+}
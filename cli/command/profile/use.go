@@ -0,0 +1,35 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/d3witt/viking/cli/command"
+	"github.com/d3witt/viking/config"
+	"github.com/urfave/cli/v2"
+)
+
+func NewUseCmd(vikingCli *command.Cli) *cli.Command {
+	return &cli.Command{
+		Name:      "use",
+		Usage:     "Make a profile the current one",
+		Args:      true,
+		ArgsUsage: "NAME",
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() != 1 {
+				return fmt.Errorf("expected 1 argument, got %d", ctx.NArg())
+			}
+
+			return runUse(vikingCli, ctx.Args().First())
+		},
+	}
+}
+
+func runUse(vikingCli *command.Cli, name string) error {
+	if err := config.UseProfile(name); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(vikingCli.Out, "Switched to profile %s.\n", name)
+
+	return nil
+}
@@ -2,9 +2,12 @@ package command
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/d3witt/viking/streams"
 )
 
 func Prompt(in io.Reader, out io.Writer, prompt, configDefault string) (string, error) {
@@ -39,3 +42,19 @@ func PromptForConfirmation(in io.Reader, out io.Writer, message string) (bool, e
 
 	return strings.EqualFold(answer, "y"), nil
 }
+
+// PromptPassword reads a password from a terminal without echoing it.
+func PromptPassword(in *streams.In, out io.Writer, prompt string) (string, error) {
+	if !in.IsTerminal() {
+		return "", errors.New("cannot prompt for a password: input is not a terminal")
+	}
+
+	fmt.Fprintf(out, "%s: ", prompt)
+	password, err := in.ReadPassword()
+	fmt.Fprintln(out)
+	if err != nil {
+		return "", fmt.Errorf("Error while reading input: %w", err)
+	}
+
+	return string(password), nil
+}
@@ -0,0 +1,282 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/d3witt/viking/sshexec"
+	"github.com/urfave/cli/v2"
+)
+
+// ErrSkipped is the error of targets that were not run because of an earlier
+// failure.
+var ErrSkipped = errors.New("skipped after an earlier failure")
+
+// ErrHealthCheck is the error of targets that ran but failed the health
+// check.
+var ErrHealthCheck = errors.New("health check failed")
+
+// ErrTimeout is the error of targets that did not complete within the
+// timeout.
+var ErrTimeout = errors.New("timed out")
+
+// RunOptions control how a command is run on multiple targets.
+type RunOptions struct {
+	// Parallel is the maximum number of targets run at once, 0 means no
+	// limit.
+	Parallel int
+	// Batch splits targets into batches run one after the other, given as a
+	// number of targets or a percentage (25%). Empty means a single batch.
+	Batch string
+	// BatchPause is the time to wait between batches.
+	BatchPause time.Duration
+	// HealthCheck is a command run on the targets of a batch once it is
+	// done. The rollout stops when it fails on any of them.
+	HealthCheck string
+	// FailFast stops starting new targets after the first failure.
+	FailFast bool
+	// Timeout is the maximum time a target may take, 0 means no limit.
+	Timeout time.Duration
+}
+
+// RunFlags returns the flags filling RunOptions, see RunOptionsFromContext.
+func RunFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "parallel",
+			Usage: "Maximum number of hosts to run on at once, 0 for no limit",
+		},
+		&cli.BoolFlag{
+			Name:  "serial",
+			Usage: "Run on one host at a time, same as --parallel 1",
+		},
+		&cli.StringFlag{
+			Name:  "batch",
+			Usage: "Run on hosts in batches of `N` hosts or N% of the hosts, one batch after the other",
+		},
+		&cli.DurationFlag{
+			Name:  "batch-pause",
+			Usage: "Time to wait between batches",
+		},
+		&cli.StringFlag{
+			Name:  "health-check",
+			Usage: "`COMMAND` run on the hosts of a batch once it is done, stops when it fails",
+		},
+		&cli.BoolFlag{
+			Name:  "fail-fast",
+			Usage: "Stop starting new hosts after the first failure",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Stop the command on hosts where it takes longer than `DURATION`, 0 for no limit",
+		},
+	}
+}
+
+func RunOptionsFromContext(ctx *cli.Context) (RunOptions, error) {
+	opts := RunOptions{
+		Parallel:    ctx.Int("parallel"),
+		Batch:       ctx.String("batch"),
+		BatchPause:  ctx.Duration("batch-pause"),
+		HealthCheck: ctx.String("health-check"),
+		FailFast:    ctx.Bool("fail-fast"),
+		Timeout:     ctx.Duration("timeout"),
+	}
+
+	if ctx.Bool("serial") {
+		opts.Parallel = 1
+	}
+
+	if opts.Parallel < 0 {
+		return opts, errors.New("parallel must not be negative")
+	}
+
+	if opts.Timeout < 0 {
+		return opts, errors.New("timeout must not be negative")
+	}
+
+	if _, err := opts.batchSize(1); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+func (o RunOptions) batchSize(total int) (int, error) {
+	if o.Batch == "" {
+		return total, nil
+	}
+
+	value, percent := strings.CutSuffix(o.Batch, "%")
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || (percent && n > 100) {
+		return 0, fmt.Errorf("invalid batch size %q", o.Batch)
+	}
+
+	if percent {
+		n = (total*n + 99) / 100
+	}
+
+	return max(min(n, total), 1), nil
+}
+
+// RunTargets calls fn for the targets as configured by opts and returns the
+// error of every target. Targets that were not run get ErrSkipped, or the
+// cause of ctx once it is done. fn gets a context that is done when ctx is
+// done or the target timed out, with a cause wrapping ErrTimeout. Progress of
+// batches is logged to c.Err.
+func (c *Cli) RunTargets(ctx context.Context, targets []Target, opts RunOptions, fn func(ctx context.Context, i int, target Target) error) []error {
+	errs := make([]error, len(targets))
+	if len(targets) == 0 {
+		return errs
+	}
+
+	size, err := opts.batchSize(len(targets))
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	var failed atomic.Bool
+	batches := (len(targets) + size - 1) / size
+
+	for start := 0; start < len(targets); start += size {
+		end := min(start+size, len(targets))
+
+		if start > 0 {
+			if opts.FailFast && failed.Load() {
+				skip(errs[start:], ErrSkipped)
+				break
+			}
+
+			if opts.BatchPause > 0 {
+				fmt.Fprintf(c.Err, "Waiting %s before the next batch.\n", opts.BatchPause)
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(opts.BatchPause):
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			skip(errs[start:], context.Cause(ctx))
+			break
+		}
+
+		if batches > 1 {
+			fmt.Fprintf(c.Err, "Batch %d/%d: %d host(s).\n", start/size+1, batches, end-start)
+		}
+
+		runBatch(ctx, targets[start:end], errs[start:end], opts, &failed, func(ctx context.Context, i int, target Target) error {
+			return fn(ctx, start+i, target)
+		})
+
+		if opts.HealthCheck != "" && !c.healthCheck(ctx, opts, targets[start:end], errs[start:end]) {
+			fmt.Fprintln(c.Err, "Health check failed, stopping.")
+			skip(errs[end:], ErrSkipped)
+			break
+		}
+	}
+
+	return errs
+}
+
+func runBatch(ctx context.Context, targets []Target, errs []error, opts RunOptions, failed *atomic.Bool, fn func(ctx context.Context, i int, target Target) error) {
+	parallel := opts.Parallel
+	if parallel == 0 {
+		parallel = len(targets)
+	}
+
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		sem <- struct{}{}
+
+		if ctx.Err() != nil {
+			<-sem
+			errs[i] = context.Cause(ctx)
+			continue
+		}
+
+		if opts.FailFast && failed.Load() {
+			<-sem
+			errs[i] = ErrSkipped
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ctx, cancel := opts.TargetContext(ctx)
+			defer cancel()
+
+			if errs[i] = fn(ctx, i, target); errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i, target)
+	}
+
+	wg.Wait()
+}
+
+// TargetContext returns the context of a single target, applying the
+// timeout.
+func (o RunOptions) TargetContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, o.Timeout, fmt.Errorf("%w after %s", ErrTimeout, o.Timeout))
+}
+
+// healthCheck runs the health check on the targets that succeeded and
+// records its failures. It reports whether all targets are healthy.
+func (c *Cli) healthCheck(ctx context.Context, opts RunOptions, targets []Target, errs []error) bool {
+	var wg sync.WaitGroup
+	var healthy atomic.Bool
+	healthy.Store(true)
+
+	for i, target := range targets {
+		if errs[i] != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+
+			ctx, cancel := opts.TargetContext(ctx)
+			defer cancel()
+
+			if err := sshexec.CommandContext(ctx, target, opts.HealthCheck).Run(); err != nil {
+				errs[i] = fmt.Errorf("%w: %w", ErrHealthCheck, err)
+				healthy.Store(false)
+			}
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	return healthy.Load()
+}
+
+func skip(errs []error, err error) {
+	for i := range errs {
+		errs[i] = err
+	}
+}
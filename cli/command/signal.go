@@ -0,0 +1,56 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/d3witt/viking/sshexec"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignalContext returns a copy of ctx that is canceled when viking receives
+// SIGINT or SIGTERM, with an sshexec.InterruptError cause so that the signal
+// is forwarded to remote commands. Once a signal was received, a second one
+// terminates viking right away. Calling stop restores the default behavior.
+func SignalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			cancel(&sshexec.InterruptError{Signal: sshSignal(sig)})
+		case <-ctx.Done():
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(sigs)
+		cancel(nil)
+	}
+
+	return ctx, stop
+}
+
+func sshSignal(sig os.Signal) ssh.Signal {
+	if sig == syscall.SIGTERM {
+		return ssh.SIGTERM
+	}
+
+	return ssh.SIGINT
+}
+
+// InterruptExitCode returns the exit code of a process killed by sig, as
+// reported by shells.
+func InterruptExitCode(sig ssh.Signal) int {
+	if sig == ssh.SIGTERM {
+		return 128 + int(syscall.SIGTERM)
+	}
+
+	return 128 + int(syscall.SIGINT)
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	backupDir = "backups"
+	// backupTimeLayout is used in backup file names, it sorts by time.
+	backupTimeLayout = "20060102T150405.000000000Z"
+	// maxBackups is the number of backups kept per profile.
+	maxBackups = 20
+)
+
+var (
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrBackupPlainText = errors.New("backup stores keys in plain text")
+)
+
+// Backup is a previous version of the config of a profile, saved before the
+// config was changed.
+type Backup struct {
+	Name      string
+	Profile   string
+	CreatedAt time.Time
+	path      string
+}
+
+func backupPath(filename string) string {
+	return filepath.Join(filepath.Dir(filename), backupDir)
+}
+
+// backupConfigFile keeps the current content of filename as backup and
+// removes the oldest backups of the profile.
+func backupConfigFile(filename string) error {
+	if !fileExists(filename) {
+		return nil
+	}
+
+	dir := backupPath(filename)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return pathError(err)
+	}
+
+	profile := strings.TrimSuffix(filepath.Base(filename), profileExt)
+	name := profile + "-" + time.Now().UTC().Format(backupTimeLayout) + profileExt
+	path := filepath.Join(dir, name)
+
+	// The config file is replaced, not modified, so a hard link is enough.
+	if err := os.Link(filename, path); err != nil {
+		if err := copyFile(filename, path); err != nil {
+			return err
+		}
+	}
+
+	backups, err := listBackups(dir, profile)
+	if err != nil {
+		return err
+	}
+
+	for i := maxBackups; i < len(backups); i++ {
+		if err := os.Remove(backups[i].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encryptBackups encrypts the keys of the backups of filename stored in plain
+// text, so that no plain text copy of them is left once the config is
+// encrypted. The backups are replaced, not modified, which also drops the
+// hard links to previous config files.
+func encryptBackups(filename string, enc *Encryption, secret []byte) error {
+	profile := strings.TrimSuffix(filepath.Base(filename), profileExt)
+
+	backups, err := listBackups(backupPath(filename), profile)
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups {
+		cfg, err := parseConfigFile(backup.path)
+		if err != nil {
+			return fmt.Errorf("failed to read backup %s: %w", backup.Name, err)
+		}
+
+		if cfg.Encrypted() {
+			continue
+		}
+
+		for name, key := range cfg.Keys {
+			if key, err = encryptKey(secret, key); err != nil {
+				return err
+			}
+
+			cfg.Keys[name] = key
+		}
+		cfg.Encryption = enc
+
+		data, err := toml.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := writeTempFile(backup.path, data)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Rename(tmp, backup.path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	syncDir(backupPath(filename))
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// listBackups returns the backups of profile in dir, newest first.
+func listBackups(dir, profile string) ([]Backup, error) {
+	files, err := filepath.Glob(filepath.Join(dir, profile+"-*"+profileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, file := range files {
+		name := filepath.Base(file)
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, profile+"-"), profileExt)
+
+		// Skip the backups of profiles sharing the prefix, e.g. prod-eu for prod.
+		t, err := time.Parse(backupTimeLayout, stamp)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{
+			Name:      strings.TrimSuffix(name, profileExt),
+			Profile:   profile,
+			CreatedAt: t,
+			path:      file,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// ListBackups returns the backups of the named profile, newest first.
+func ListBackups(profile string) ([]Backup, error) {
+	filename, err := profileFile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return listBackups(backupPath(filename), profile)
+}
+
+// ParseBackup reads the config saved in backup.
+func ParseBackup(backup Backup) (Config, error) {
+	cfg, err := parseConfigFile(backup.path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read backup %s: %w", backup.Name, err)
+	}
+
+	cfg.profile = backup.Profile
+
+	return cfg, nil
+}
+
+// RestoreBackup replaces the config of the named profile with the backup of
+// the given name, the latest one if name is empty. The replaced config is
+// backed up as well. Backups with plain text keys cannot be restored into an
+// encrypted config.
+func RestoreBackup(profile, name string) (Backup, error) {
+	backups, err := ListBackups(profile)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	var backup Backup
+	for _, b := range backups {
+		if name == "" || b.Name == name {
+			backup = b
+			break
+		}
+	}
+
+	if backup.path == "" {
+		if name == "" {
+			return Backup{}, fmt.Errorf("%w: profile %s has no backups", ErrBackupNotFound, profile)
+		}
+
+		return Backup{}, fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+	}
+
+	// Make sure the backup is a valid config before restoring it.
+	cfg, err := ParseBackup(backup)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	data, err := readConfigFile(backup.path)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	filename, err := profileFile(profile)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	unlock, err := lockConfig(filename)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer unlock()
+
+	// Restoring plain text keys would silently undo the encryption.
+	current, err := parseConfig(filename)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if current.Encrypted() && !cfg.Encrypted() {
+		return Backup{}, fmt.Errorf("%w: %s, the config of profile %s is encrypted", ErrBackupPlainText, backup.Name, profile)
+	}
+
+	return backup, writeConfigFile(filename, data)
+}
@@ -5,9 +5,21 @@ import (
 )
 
 type Config struct {
-	Keys     map[string]Key
-	Machines map[string]Machine
-	Profile  Profile
+	Keys       map[string]Key
+	Machines   map[string]Machine
+	Profile    Profile
+	Encryption *Encryption `toml:",omitempty"`
+
+	// Password returns the master password. It is called once, when
+	// encrypted keys are accessed for the first time.
+	Password func() (string, error) `toml:"-"`
+	// Cache keeps the unlocked encryption key across viking processes, so
+	// that the master password is asked for once per session. Optional.
+	Cache SecretCache `toml:"-"`
+
+	secret []byte
+	// profile is the name of the profile the config belongs to.
+	profile string
 }
 
 func defaultConfig() Config {
@@ -17,16 +29,78 @@ func defaultConfig() Config {
 	}
 }
 
+// ProfileName returns the name of the profile the config belongs to.
+func (c *Config) ProfileName() string {
+	if c.profile == "" {
+		return DefaultProfileName
+	}
+
+	return c.profile
+}
+
+// Save writes the whole config, replacing the stored one. Prefer update for
+// changes, it keeps the changes made by other processes.
 func (c Config) Save() error {
-	filename, err := configFile()
+	filename, err := profileFile(c.ProfileName())
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(filename)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+
+	return c.write(filename)
+}
 
-	data, err := toml.Marshal(&c)
+func (c *Config) write(filename string) error {
+	data, err := toml.Marshal(c)
 	if err != nil {
 		return err
 	}
 
 	return writeConfigFile(filename, data)
 }
+
+// update applies fn to the stored config and saves it while holding the
+// config lock, so that viking processes running at the same time do not
+// overwrite each other's changes. On success c is replaced by the saved
+// config.
+func (c *Config) update(fn func(latest *Config) error) error {
+	filename, err := profileFile(c.ProfileName())
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	latest, err := parseConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	latest.Password = c.Password
+	latest.Cache = c.Cache
+	latest.profile = c.profile
+	if sameEncryption(c.Encryption, latest.Encryption) {
+		latest.secret = c.secret
+	}
+
+	if err := fn(&latest); err != nil {
+		return err
+	}
+
+	if err := latest.write(filename); err != nil {
+		return err
+	}
+
+	*c = latest
+
+	return nil
+}
@@ -47,22 +47,14 @@ func fileExists(path string) bool {
 	return err == nil && !f.IsDir()
 }
 
-func configFile() (string, error) {
+// KnownHostsFile returns the path of the known_hosts file managed by viking.
+func KnownHostsFile() (string, error) {
 	path, err := ConfigDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(path, defaultProfileName+".toml"), nil
-}
-
-func ParseDefaultConfig() (Config, error) {
-	path, err := configFile()
-	if err != nil {
-		return Config{}, err
-	}
-
-	return parseConfig(path)
+	return filepath.Join(path, "known_hosts"), nil
 }
 
 func readConfigFile(filename string) ([]byte, error) {
@@ -80,20 +72,74 @@ func readConfigFile(filename string) ([]byte, error) {
 	return data, nil
 }
 
+// writeConfigFile replaces filename with data. The data is written to a
+// temporary file first, synced and renamed over filename, so that the config
+// is never left half written. The previous version is kept as backup.
 func writeConfigFile(filename string, data []byte) error {
-	err := os.MkdirAll(filepath.Dir(filename), 0o771)
+	dir := filepath.Dir(filename)
+
+	err := os.MkdirAll(dir, 0o771)
 	if err != nil {
 		return pathError(err)
 	}
 
-	cfgFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600) // cargo coded from setup
+	tmp, err := writeTempFile(filename, data)
 	if err != nil {
 		return err
 	}
-	defer cfgFile.Close()
+	defer os.Remove(tmp)
 
-	_, err = cfgFile.Write(data)
-	return err
+	if err := backupConfigFile(filename); err != nil {
+		return fmt.Errorf("failed to back up config: %w", err)
+	}
+
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+
+	return nil
+}
+
+// writeTempFile writes data to a new temporary file next to filename, to be
+// renamed over it, and returns its path.
+func writeTempFile(filename string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// syncDir flushes the directory entries of dir, making a rename durable.
+// Not all platforms support it, errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	_ = d.Sync()
 }
 
 func parseConfigFile(filename string) (cfg Config, err error) {
@@ -112,9 +158,18 @@ func parseConfig(filename string) (Config, error) {
 		if os.IsNotExist(err) {
 			return defaultConfig(), nil
 		}
+
+		return cfg, err
+	}
+
+	if cfg.Keys == nil {
+		cfg.Keys = make(map[string]Key)
+	}
+	if cfg.Machines == nil {
+		cfg.Machines = make(map[string]Machine)
 	}
 
-	return cfg, err
+	return cfg, nil
 }
 
 func pathError(err error) error {
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encryption holds the parameters used to encrypt private keys and
+// passphrases with a master password. Values are sealed with AES-256-GCM
+// using a key derived from the password with scrypt.
+type Encryption struct {
+	Salt string
+	N    int
+	R    int
+	P    int
+	// Check is a known value sealed with the derived key, used to verify the
+	// master password.
+	Check string
+}
+
+const (
+	encryptedPrefix = "viking:enc:v1:"
+	checkValue      = "viking"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrConfigEncrypted    = errors.New("config is already encrypted")
+	ErrConfigNotEncrypted = errors.New("config is not encrypted")
+	ErrWrongPassword      = errors.New("wrong master password")
+	ErrPasswordRequired   = errors.New("master password is required")
+)
+
+// SecretCache keeps the keys derived from master passwords, identified by
+// the salt they were derived with.
+type SecretCache interface {
+	// Secret returns the cached key, nil if there is none.
+	Secret(id string) ([]byte, error)
+	// CacheSecret caches the key.
+	CacheSecret(id string, secret []byte) error
+}
+
+// Encrypted reports whether key material is encrypted.
+func (c *Config) Encrypted() bool {
+	return c.Encryption != nil
+}
+
+// Unlock derives the encryption key from the master password, asking for it
+// with Password. The key is kept for the lifetime of the Config, and in Cache
+// if set. Cache errors are not fatal, the password is asked for instead.
+func (c *Config) Unlock() error {
+	if !c.Encrypted() {
+		return ErrConfigNotEncrypted
+	}
+
+	if c.secret != nil {
+		return nil
+	}
+
+	if c.Cache != nil {
+		if secret, err := c.Cache.Secret(c.Encryption.Salt); err == nil && secret != nil {
+			if check, err := open(secret, c.Encryption.Check); err == nil && check == checkValue {
+				c.secret = secret
+				return nil
+			}
+		}
+	}
+
+	if c.Password == nil {
+		return ErrPasswordRequired
+	}
+
+	password, err := c.Password()
+	if err != nil {
+		return err
+	}
+
+	secret, err := c.Encryption.derive(password)
+	if err != nil {
+		return err
+	}
+
+	check, err := open(secret, c.Encryption.Check)
+	if err != nil || check != checkValue {
+		return ErrWrongPassword
+	}
+
+	c.secret = secret
+
+	if c.Cache != nil {
+		_ = c.Cache.CacheSecret(c.Encryption.Salt, secret)
+	}
+
+	return nil
+}
+
+// DecryptKey returns key with its private key and passphrase in plain text.
+func (c *Config) DecryptKey(key Key) (Key, error) {
+	if !isEncrypted(key.Private) && !isEncrypted(key.Passphrase) {
+		return key, nil
+	}
+
+	if err := c.Unlock(); err != nil {
+		return key, err
+	}
+
+	var err error
+	if key.Private, err = open(c.secret, key.Private); err != nil {
+		return key, fmt.Errorf("failed to decrypt key %s: %w", key.Name, err)
+	}
+	if key.Passphrase, err = open(c.secret, key.Passphrase); err != nil {
+		return key, fmt.Errorf("failed to decrypt key %s: %w", key.Name, err)
+	}
+
+	return key, nil
+}
+
+// EncryptKeys encrypts all keys with the given master password and saves the
+// config. The keys of the backups of the profile are encrypted as well.
+func (c *Config) EncryptKeys(password string) error {
+	if c.Encrypted() {
+		return ErrConfigEncrypted
+	}
+
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	enc := &Encryption{
+		Salt: base64.StdEncoding.EncodeToString(salt),
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+	}
+
+	secret, err := enc.derive(password)
+	if err != nil {
+		return err
+	}
+
+	if enc.Check, err = seal(secret, checkValue); err != nil {
+		return err
+	}
+
+	err = c.update(func(c *Config) error {
+		if c.Encrypted() {
+			return ErrConfigEncrypted
+		}
+
+		for name, key := range c.Keys {
+			if key, err = encryptKey(secret, key); err != nil {
+				return err
+			}
+
+			c.Keys[name] = key
+		}
+
+		c.Encryption = enc
+		c.secret = secret
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.Cache != nil {
+		_ = c.Cache.CacheSecret(enc.Salt, secret)
+	}
+
+	// The backups, including the one just made, still hold the keys in
+	// plain text.
+	filename, err := profileFile(c.ProfileName())
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := encryptBackups(filename, enc, secret); err != nil {
+		return fmt.Errorf("keys encrypted, but not in the backups: %w", err)
+	}
+
+	return nil
+}
+
+// DecryptKeys stores all keys in plain text again and saves the config.
+func (c *Config) DecryptKeys() error {
+	if !c.Encrypted() {
+		return ErrConfigNotEncrypted
+	}
+
+	// Ask for the master password before the config is locked.
+	if err := c.Unlock(); err != nil {
+		return err
+	}
+
+	return c.update(func(c *Config) error {
+		if !c.Encrypted() {
+			return ErrConfigNotEncrypted
+		}
+
+		for name, key := range c.Keys {
+			key, err := c.DecryptKey(key)
+			if err != nil {
+				return err
+			}
+
+			c.Keys[name] = key
+		}
+
+		c.Encryption = nil
+		c.secret = nil
+
+		return nil
+	})
+}
+
+// sameEncryption reports whether a and b encrypt with the same key.
+func sameEncryption(a, b *Encryption) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// sealKey encrypts key when the config is encrypted.
+func (c *Config) sealKey(key Key) (Key, error) {
+	if !c.Encrypted() {
+		return key, nil
+	}
+
+	if err := c.Unlock(); err != nil {
+		return key, err
+	}
+
+	return encryptKey(c.secret, key)
+}
+
+func encryptKey(secret []byte, key Key) (Key, error) {
+	var err error
+
+	if key.Private, err = seal(secret, key.Private); err != nil {
+		return key, err
+	}
+	if key.Passphrase, err = seal(secret, key.Passphrase); err != nil {
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (e *Encryption) derive(password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption salt: %w", err)
+	}
+
+	return scrypt.Key([]byte(password), salt, e.N, e.R, e.P, 32)
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// seal encrypts value. Empty and already encrypted values are kept as is.
+func seal(secret []byte, value string) (string, error) {
+	if value == "" || isEncrypted(value) {
+		return value, nil
+	}
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts value. Plain text values are returned as is.
+func open(secret []byte, value string) (string, error) {
+	if !isEncrypted(value) {
+		return value, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(secret)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+func newGCM(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
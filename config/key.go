@@ -5,6 +5,8 @@ import (
 	"time"
 )
 
+// Key is an SSH key pair. Private and Passphrase are encrypted when the
+// config is encrypted, use Config.DecryptKey to access them.
 type Key struct {
 	Name       string `toml:"-"`
 	Private    string
@@ -31,25 +33,41 @@ func (c *Config) ListKeys() []Key {
 }
 
 func (c *Config) AddKey(key Key) error {
-	_, err := c.GetKeyByName(key.Name)
-	if err == nil {
-		return ErrKeyExist
+	// Ask for the master password before the config is locked.
+	if c.Encrypted() {
+		if err := c.Unlock(); err != nil {
+			return err
+		}
 	}
 
-	c.Keys[key.Name] = key
+	return c.update(func(c *Config) error {
+		_, err := c.GetKeyByName(key.Name)
+		if err == nil {
+			return ErrKeyExist
+		}
 
-	return c.Save()
+		key, err := c.sealKey(key)
+		if err != nil {
+			return err
+		}
+
+		c.Keys[key.Name] = key
+
+		return nil
+	})
 }
 
 func (c *Config) RemoveKey(name string) error {
-	_, err := c.GetKeyByName(name)
-	if err != nil {
-		return err
-	}
+	return c.update(func(c *Config) error {
+		_, err := c.GetKeyByName(name)
+		if err != nil {
+			return err
+		}
 
-	delete(c.Keys, name)
+		delete(c.Keys, name)
 
-	return c.Save()
+		return nil
+	})
 }
 
 func (c *Config) GetKeyByName(name string) (Key, error) {
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	// lockTimeout is how long a config lock held by another process is
+	// waited for.
+	lockTimeout = 10 * time.Second
+	lockPoll    = 50 * time.Millisecond
+)
+
+var ErrConfigLocked = errors.New("config is locked by another viking process")
+
+// lockConfig locks the config file filename for writing. The lock is held on
+// a separate file since the config file is replaced when saved. It returns
+// a function releasing the lock.
+func lockConfig(filename string) (func(), error) {
+	f, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrConfigLocked
+		}
+
+		time.Sleep(lockPoll)
+	}
+
+	return func() {
+		_ = unlock(f)
+		f.Close()
+	}, nil
+}
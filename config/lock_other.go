@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package config
+
+import "os"
+
+// tryLock does nothing on platforms without file locks.
+func tryLock(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlock(f *os.File) error {
+	return nil
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,21 +13,151 @@ type Machine struct {
 	Name      string `toml:"-"`
 	Hosts     []Host
 	CreatedAt time.Time
+	// Jump is the jump host used for all hosts of the machine, unless a
+	// host names its own. See Host.Jump.
+	Jump string `toml:",omitempty"`
+	// Tags apply to all hosts of the machine.
+	Tags map[string]string `toml:",omitempty"`
+
+	// hostIndex maps the hosts kept by SelectMachines to their index in the
+	// config.
+	hostIndex []int
+}
+
+// HostIndex returns the index in the config of the i-th host of the machine,
+// which differs from i when SelectMachines left out some of its hosts.
+func (m Machine) HostIndex(i int) int {
+	if m.hostIndex == nil {
+		return i
+	}
+
+	return m.hostIndex[i]
 }
 
 type Host struct {
-	IP   net.IP
-	Port int
-	User string
-	Key  string
+	// Address is the hostname or IP address of the host, resolved when
+	// connecting. It is stored as IP, the name used when only IP addresses
+	// were supported, so that configs stay compatible.
+	Address string `toml:"IP"`
+	Port    int
+	User    string
+	Key     string
+	// Jump is a comma separated chain of jump hosts used to reach the host.
+	// Each element is either a machine name or a [USER@]HOST[:PORT] spec,
+	// the last element being the closest to the host.
+	Jump string `toml:",omitempty"`
+	// JumpKey is the key used to log in to the jump hosts of Jump given as
+	// [USER@]HOST[:PORT] specs, Key when empty. Jump machines log in with
+	// their own keys.
+	JumpKey string `toml:",omitempty"`
+	// Tags are merged with the machine tags, host tags take precedence.
+	Tags map[string]string `toml:",omitempty"`
+	// ResolveAll turns every A and AAAA record of Address into a host of its
+	// own when connecting.
+	ResolveAll bool `toml:",omitempty"`
+}
+
+// ValidateAddress checks that addr is an IP address or a valid hostname.
+func ValidateAddress(addr string) error {
+	if net.ParseIP(addr) != nil {
+		return nil
+	}
+
+	name := strings.TrimSuffix(addr, ".")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+		}
+
+		for _, r := range label {
+			if !isHostnameChar(r) {
+				return fmt.Errorf("%w: %q", ErrInvalidAddress, addr)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isHostnameChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
+
+// EffectiveHosts returns the hosts of the machine with the machine defaults
+// applied.
+func (m Machine) EffectiveHosts() []Host {
+	hosts := make([]Host, len(m.Hosts))
+	for i, host := range m.Hosts {
+		if host.Jump == "" {
+			host.Jump = m.Jump
+		}
+
+		if len(m.Tags) > 0 {
+			tags := make(map[string]string, len(m.Tags)+len(host.Tags))
+			for k, v := range m.Tags {
+				tags[k] = v
+			}
+			for k, v := range host.Tags {
+				tags[k] = v
+			}
+
+			host.Tags = tags
+		}
+
+		hosts[i] = host
+	}
+
+	return hosts
+}
+
+// EffectiveJumpKey returns the key used to log in to the jump hosts given as
+// specs, see JumpKey.
+func (h Host) EffectiveJumpKey() string {
+	if h.JumpKey != "" {
+		return h.JumpKey
+	}
+
+	return h.Key
+}
+
+// SplitJump splits a jump host chain into its elements.
+func SplitJump(jump string) []string {
+	var chain []string
+	for _, j := range strings.Split(jump, ",") {
+		if j = strings.TrimSpace(j); j != "" {
+			chain = append(chain, j)
+		}
+	}
+
+	return chain
 }
 
 var (
 	ErrMachineNotFound           = errors.New("machine not found")
 	ErrMachineAlreadyExists      = errors.New("machine already exists")
 	ErrMachineNameOrHostRequired = errors.New("machine name or host is required")
+	ErrHostNotFound              = errors.New("host not found")
+	ErrInvalidAddress            = errors.New("invalid host address")
+	ErrMachineHasNoHosts         = errors.New("machine must have at least one host")
 )
 
+// FindHost returns the index of the host with the given address, given as
+// HOST or HOST:PORT. IPv6 addresses with a port are enclosed in brackets.
+func (m Machine) FindHost(addr string) (int, error) {
+	for i, host := range m.Hosts {
+		if strings.EqualFold(addr, host.Address) ||
+			strings.EqualFold(addr, net.JoinHostPort(host.Address, strconv.Itoa(host.Port))) {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("%w: %s", ErrHostNotFound, addr)
+}
+
 func (c *Config) ListMachines() []Machine {
 	machines := make([]Machine, 0, len(c.Machines))
 
@@ -46,24 +179,102 @@ func (c *Config) GetMachineByName(name string) (Machine, error) {
 }
 
 func (c *Config) AddMachine(machine Machine) error {
-	_, err := c.GetMachineByName(machine.Name)
-	if err == nil {
-		return ErrMachineAlreadyExists
+	return c.update(func(c *Config) error {
+		_, err := c.GetMachineByName(machine.Name)
+		if err == nil {
+			return ErrMachineAlreadyExists
+		}
+
+		if len(machine.Hosts) == 0 {
+			return ErrMachineHasNoHosts
+		}
+
+		c.Machines[machine.Name] = machine
+
+		return nil
+	})
+}
+
+// UpdateMachine applies fn to the named machine and saves the config.
+func (c *Config) UpdateMachine(name string, fn func(m *Machine) error) error {
+	return c.update(func(c *Config) error {
+		m, err := c.GetMachineByName(name)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&m); err != nil {
+			return err
+		}
+
+		if len(m.Hosts) == 0 {
+			return ErrMachineHasNoHosts
+		}
+
+		c.Machines[name] = m
+
+		return nil
+	})
+}
+
+// RenameMachine renames a machine and updates the jump host chains
+// referring to it.
+func (c *Config) RenameMachine(name, newName string) error {
+	return c.update(func(c *Config) error {
+		m, err := c.GetMachineByName(name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.GetMachineByName(newName); err == nil {
+			return ErrMachineAlreadyExists
+		}
+
+		delete(c.Machines, name)
+		c.Machines[newName] = m
+
+		for n, other := range c.Machines {
+			other.Jump = renameJump(other.Jump, name, newName)
+			for i := range other.Hosts {
+				other.Hosts[i].Jump = renameJump(other.Hosts[i].Jump, name, newName)
+			}
+
+			c.Machines[n] = other
+		}
+
+		return nil
+	})
+}
+
+// renameJump replaces the machine name in the jump host chain.
+func renameJump(jump, name, newName string) string {
+	chain := SplitJump(jump)
+
+	renamed := false
+	for i, j := range chain {
+		if j == name {
+			chain[i] = newName
+			renamed = true
+		}
 	}
 
-	c.Machines[machine.Name] = machine
+	if !renamed {
+		return jump
+	}
 
-	return c.Save()
+	return strings.Join(chain, ",")
 }
 
 // RemoveMachine removes a machine from the config by name or host.
 func (c *Config) RemoveMachine(machine string) error {
-	m, err := c.GetMachineByName(machine)
-	if err != nil {
-		return err
-	}
+	return c.update(func(c *Config) error {
+		m, err := c.GetMachineByName(machine)
+		if err != nil {
+			return err
+		}
 
-	delete(c.Machines, m.Name)
+		delete(c.Machines, m.Name)
 
-	return c.Save()
+		return nil
+	})
 }
@@ -1,7 +1,230 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
 type Profile struct {
 	Email string
 }
 
-const defaultProfileName = "default"
+const (
+	// VIKING_PROFILE selects the profile, overriding the current one.
+	VIKING_PROFILE = "VIKING_PROFILE"
+
+	// DefaultProfileName is the profile used until another one is selected.
+	DefaultProfileName = "default"
+
+	// currentProfileFile stores the name of the profile selected with
+	// UseProfile.
+	currentProfileFile = "current_profile"
+
+	profileExt = ".toml"
+)
+
+var (
+	ErrProfileNotFound    = errors.New("profile not found")
+	ErrProfileExists      = errors.New("profile already exists")
+	ErrInvalidProfileName = errors.New("invalid profile name")
+	ErrProfileInUse       = errors.New("profile is in use")
+	ErrDefaultProfile     = errors.New("the default profile cannot be removed")
+)
+
+// ValidateProfileName checks that name can be used as a profile name, it is
+// used as file name.
+func ValidateProfileName(name string) error {
+	if name == "" || name == currentProfileFile || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("%w: %q", ErrInvalidProfileName, name)
+	}
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("%w: %q", ErrInvalidProfileName, name)
+		}
+	}
+
+	return nil
+}
+
+func profileFile(name string) (string, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return "", err
+	}
+
+	path, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, name+profileExt), nil
+}
+
+// ProfileExists reports whether the named profile exists. The default
+// profile always exists.
+func ProfileExists(name string) (bool, error) {
+	if name == DefaultProfileName {
+		return true, nil
+	}
+
+	filename, err := profileFile(name)
+	if err != nil {
+		return false, err
+	}
+
+	return fileExists(filename), nil
+}
+
+// ListProfiles returns the names of all profiles, sorted.
+func ListProfiles() ([]string, error) {
+	path, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*"+profileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{DefaultProfileName}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), profileExt)
+		if name != DefaultProfileName && ValidateProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// CurrentProfile returns the name of the profile selected with UseProfile,
+// the default profile if none was.
+func CurrentProfile() (string, error) {
+	path, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, currentProfileFile))
+	if os.IsNotExist(err) {
+		return DefaultProfileName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return DefaultProfileName, nil
+	}
+
+	return name, nil
+}
+
+// UseProfile makes the named profile the current one.
+func UseProfile(name string) error {
+	if err := requireProfile(name); err != nil {
+		return err
+	}
+
+	path, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(path, currentProfileFile), []byte(name+"\n"), 0o600)
+}
+
+// CreateProfile creates an empty profile.
+func CreateProfile(name string) error {
+	exists, err := ProfileExists(name)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("%w: %s", ErrProfileExists, name)
+	}
+
+	cfg := defaultConfig()
+	cfg.profile = name
+
+	return cfg.Save()
+}
+
+// RemoveProfile deletes the named profile. Its backups are kept. The current
+// profile and the default one cannot be removed.
+func RemoveProfile(name string) error {
+	if name == DefaultProfileName {
+		return ErrDefaultProfile
+	}
+
+	if err := requireProfile(name); err != nil {
+		return err
+	}
+
+	current, err := CurrentProfile()
+	if err != nil {
+		return err
+	}
+
+	if name == current {
+		return fmt.Errorf("%w: %s is the current profile, switch to another one first", ErrProfileInUse, name)
+	}
+
+	filename, err := profileFile(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Remove(filename + ".lock"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func requireProfile(name string) error {
+	exists, err := ProfileExists(name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	return nil
+}
+
+// ParseProfileConfig reads the config of the named profile.
+func ParseProfileConfig(name string) (Config, error) {
+	if err := requireProfile(name); err != nil {
+		return Config{}, err
+	}
+
+	filename, err := profileFile(name)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := parseConfig(filename)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.profile = name
+
+	return cfg, nil
+}
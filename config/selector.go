@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Selector selects hosts by machine name and tags.
+//
+// A selector is a union of alternatives separated by "|", a host is selected
+// when any of them matches. An alternative is a list of terms separated by
+// "," which all have to match. A term is one of:
+//
+//	NAME       machine name or tag key, glob patterns are allowed (db-*)
+//	KEY=VALUE  tag with the given value, glob patterns are allowed (region=eu-*)
+//	!TERM      the term does not match
+//
+// For example "role=web,region=eu|db-*,!backup" selects the web hosts in eu
+// and all db machines that are not tagged as backup.
+type Selector [][]selectorTerm
+
+type selectorTerm struct {
+	negate bool
+	key    string
+	value  string
+	hasVal bool
+}
+
+var ErrInvalidSelector = errors.New("invalid selector")
+
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+
+	for _, alt := range strings.Split(s, "|") {
+		var terms []selectorTerm
+
+		for _, raw := range strings.Split(alt, ",") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+
+			var t selectorTerm
+			if strings.HasPrefix(raw, "!") {
+				t.negate = true
+				raw = strings.TrimSpace(raw[1:])
+			}
+
+			t.key, t.value, t.hasVal = strings.Cut(raw, "=")
+			if t.key == "" {
+				return nil, fmt.Errorf("%w %q: empty term", ErrInvalidSelector, s)
+			}
+
+			for _, p := range []string{t.key, t.value} {
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("%w %q: %v", ErrInvalidSelector, s, err)
+				}
+			}
+
+			terms = append(terms, t)
+		}
+
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("%w %q: empty alternative", ErrInvalidSelector, s)
+		}
+
+		sel = append(sel, terms)
+	}
+
+	return sel, nil
+}
+
+// Match reports whether a host of the named machine with the given tags is
+// selected.
+func (s Selector) Match(machine string, tags map[string]string) bool {
+	for _, terms := range s {
+		matched := true
+		for _, t := range terms {
+			if t.match(machine, tags) == t.negate {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t selectorTerm) match(machine string, tags map[string]string) bool {
+	if t.hasVal {
+		for k, v := range tags {
+			if globMatch(t.key, k) && globMatch(t.value, v) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if globMatch(t.key, machine) {
+		return true
+	}
+
+	for k := range tags {
+		if globMatch(t.key, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func globMatch(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// SelectMachines returns the machines matching selector, keeping only their
+// selected hosts, see Machine.HostIndex. A machine name always selects
+// exactly that machine.
+func (c *Config) SelectMachines(selector string) ([]Machine, error) {
+	if m, err := c.GetMachineByName(selector); err == nil {
+		return []Machine{m}, nil
+	}
+
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var machines []Machine
+	for _, m := range c.ListMachines() {
+		var hosts []Host
+		var index []int
+		for i, host := range m.EffectiveHosts() {
+			if sel.Match(m.Name, host.Tags) {
+				hosts = append(hosts, m.Hosts[i])
+				index = append(index, i)
+			}
+		}
+
+		if len(hosts) > 0 {
+			m.Hosts = hosts
+			m.hostIndex = index
+			machines = append(machines, m)
+		}
+	}
+
+	if len(machines) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrMachineNotFound, selector)
+	}
+
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	return machines, nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectorMatch(t *testing.T) {
+	web := map[string]string{"role": "web", "region": "eu-west"}
+	backup := map[string]string{"role": "db", "region": "us-east", "backup": ""}
+
+	tests := []struct {
+		selector string
+		machine  string
+		tags     map[string]string
+		want     bool
+	}{
+		// Machine names and tag keys.
+		{"deathstar", "deathstar", nil, true},
+		{"deathstar", "tantive", nil, false},
+		{"role", "tantive", web, true},
+		{"backup", "tantive", backup, true},
+		{"backup", "tantive", web, false},
+
+		// KEY=VALUE.
+		{"role=web", "tantive", web, true},
+		{"role=db", "tantive", web, false},
+		{"backup=", "tantive", backup, true},
+		{"role=", "tantive", web, false},
+		{"tantive=web", "tantive", nil, false},
+
+		// Globs in names, keys and values.
+		{"db-*", "db-1", nil, true},
+		{"db-*", "web-1", nil, false},
+		{"db-?", "db-12", nil, false},
+		{"region=eu-*", "tantive", web, true},
+		{"region=eu-*", "tantive", backup, false},
+		{"reg*=us-*", "tantive", backup, true},
+		{"*", "tantive", nil, true},
+
+		// "," requires all terms.
+		{"role=web,region=eu-west", "tantive", web, true},
+		{"role=web,region=us-east", "tantive", web, false},
+
+		// "|" requires any alternative.
+		{"role=db|region=eu-*", "tantive", web, true},
+		{"role=db|region=us-*", "tantive", web, false},
+
+		// Negation.
+		{"!backup", "tantive", web, true},
+		{"!backup", "tantive", backup, false},
+		{"!role=web", "tantive", web, false},
+		{"! role=web", "tantive", backup, true},
+		{"!db-*", "db-1", nil, false},
+
+		// "," binds tighter than "|", "!" applies to a single term.
+		{"role=web,region=eu-*|db-*,!backup", "tantive", web, true},
+		{"role=web,region=eu-*|db-*,!backup", "db-1", backup, false},
+		{"role=web,region=eu-*|db-*,!backup", "db-2", map[string]string{"role": "db"}, true},
+		{"role=web,region=eu-*|db-*,!backup", "tantive", backup, false},
+		{"!backup,role=db", "tantive", backup, false},
+		{"!backup|role=db", "tantive", backup, true},
+
+		// Spaces around terms are ignored.
+		{" role=web , region=eu-west ", "tantive", web, true},
+	}
+
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.selector, err)
+			continue
+		}
+
+		if got := sel.Match(tt.machine, tt.tags); got != tt.want {
+			t.Errorf("%q matching %s %v = %v, want %v", tt.selector, tt.machine, tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, selector := range []string{
+		"",
+		",",
+		"role=web|",
+		"|role=web",
+		"!",
+		"=web",
+		"!=web",
+		"db-[",
+		"role=[",
+	} {
+		if _, err := ParseSelector(selector); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("ParseSelector(%q) error = %v, want %v", selector, err, ErrInvalidSelector)
+		}
+	}
+}
+
+func TestSelectMachines(t *testing.T) {
+	cfg := &Config{
+		Machines: map[string]Machine{
+			"web": {
+				Hosts: []Host{{Address: "10.0.0.1"}},
+			},
+			"api": {
+				Hosts: []Host{{Address: "10.0.1.1"}},
+				Tags:  map[string]string{"web": "", "region": "eu"},
+			},
+			"db": {
+				Hosts: []Host{
+					{Address: "10.0.2.1", Tags: map[string]string{"backup": ""}},
+					{Address: "10.0.2.2"},
+					{Address: "10.0.2.3", Tags: map[string]string{"backup": ""}},
+				},
+				Tags: map[string]string{"region": "eu"},
+			},
+			"db-*": {
+				Hosts: []Host{{Address: "10.0.3.1"}},
+			},
+		},
+	}
+
+	// selected maps machine names to the config indexes of their hosts.
+	type selected map[string][]int
+
+	tests := []struct {
+		selector string
+		want     selected
+	}{
+		// A machine name selects exactly that machine, with all its hosts,
+		// even when it also matches tags or globs of other machines.
+		{"web", selected{"web": {0}}},
+		{"db", selected{"db": {0, 1, 2}}},
+		{"db-*", selected{"db-*": {0}}},
+
+		{"web|api", selected{"web": {0}, "api": {0}}},
+		{"web,region=eu", selected{"api": {0}}},
+		{"backup", selected{"db": {0, 2}}},
+		{"region=eu,!backup", selected{"api": {0}, "db": {1}}},
+		{"d*", selected{"db": {0, 1, 2}, "db-*": {0}}},
+	}
+
+	for _, tt := range tests {
+		machines, err := cfg.SelectMachines(tt.selector)
+		if err != nil {
+			t.Errorf("SelectMachines(%q): %v", tt.selector, err)
+			continue
+		}
+
+		got := selected{}
+		for _, m := range machines {
+			for i, host := range m.Hosts {
+				got[m.Name] = append(got[m.Name], m.HostIndex(i))
+
+				if want := cfg.Machines[m.Name].Hosts[m.HostIndex(i)]; !reflect.DeepEqual(host, want) {
+					t.Errorf("SelectMachines(%q): host %d of %s is %v, want %v", tt.selector, i, m.Name, host, want)
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SelectMachines(%q) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+
+	if _, err := cfg.SelectMachines("role=cache"); !errors.Is(err, ErrMachineNotFound) {
+		t.Errorf("SelectMachines without match error = %v, want %v", err, ErrMachineNotFound)
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseTag parses a KEY[=VALUE] tag.
+func ParseTag(s string) (key, value string, err error) {
+	key, value, _ = strings.Cut(s, "=")
+	if key == "" || strings.HasPrefix(key, "-") || strings.ContainsAny(key, ",|!*?[] \t") || strings.ContainsAny(value, ",|") {
+		return "", "", fmt.Errorf("invalid tag %q", s)
+	}
+
+	return key, value, nil
+}
+
+// FormatTags returns the tags as a sorted, comma separated list.
+func FormatTags(tags map[string]string) string {
+	list := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v == "" {
+			list = append(list, k)
+		} else {
+			list = append(list, k+"="+v)
+		}
+	}
+
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
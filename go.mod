@@ -5,6 +5,7 @@ go 1.22.1
 require (
 	golang.org/x/crypto v0.26.0
 	golang.org/x/term v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -24,5 +25,5 @@ require (
 	github.com/schollz/progressbar/v3 v3.14.6
 	github.com/urfave/cli/v2 v2.27.2
 	golang.design/x/clipboard v0.7.0
-	golang.org/x/sys v0.23.0 // indirect
+	golang.org/x/sys v0.23.0
 )
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/d3witt/viking/cli/command"
 	"github.com/d3witt/viking/cli/command/cfg"
+	"github.com/d3witt/viking/cli/command/hostkey"
 	"github.com/d3witt/viking/cli/command/key"
 	"github.com/d3witt/viking/cli/command/machine"
+	"github.com/d3witt/viking/cli/command/profile"
 	"github.com/d3witt/viking/config"
 	"github.com/d3witt/viking/streams"
 	"github.com/urfave/cli/v2"
@@ -18,18 +22,11 @@ import (
 var version = "dev" // set by build script
 
 func main() {
-	c, err := config.ParseDefaultConfig()
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-
 	cmdLogger := slog.New(command.NewCmdLogHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	}))
 
 	vikingCli := &command.Cli{
-		Config:    &c,
 		In:        streams.StdIn,
 		Out:       streams.StdOut,
 		Err:       streams.StdErr,
@@ -40,14 +37,65 @@ func main() {
 		Name:    "viking",
 		Usage:   "Manage your SSH keys and remote machines",
 		Version: version,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Use the profile `NAME` instead of the current one",
+				EnvVars: []string{config.VIKING_PROFILE},
+			},
+			&cli.BoolFlag{
+				Name:    "strict-host-keys",
+				Usage:   "Refuse to connect to hosts with unknown host keys",
+				EnvVars: []string{"VIKING_STRICT_HOST_KEYS"},
+			},
+			&cli.BoolFlag{
+				Name:    "ssh-known-hosts",
+				Usage:   "Also trust host keys from ~/.ssh/known_hosts",
+				EnvVars: []string{"VIKING_SSH_KNOWN_HOSTS"},
+			},
+			&cli.DurationFlag{
+				Name:    "unlock-ttl",
+				Usage:   "Keep the master password unlocked for `DURATION` across commands, 0 to ask for it every time",
+				Value:   15 * time.Minute,
+				EnvVars: []string{"VIKING_UNLOCK_TTL"},
+			},
+		},
+		Before: func(ctx *cli.Context) error {
+			profile := ctx.String("profile")
+			if profile == "" {
+				var err error
+				if profile, err = config.CurrentProfile(); err != nil {
+					return err
+				}
+			}
+
+			c, err := config.ParseProfileConfig(profile)
+			if err != nil {
+				return err
+			}
+
+			c.Password = vikingCli.MasterPassword
+			if ttl := ctx.Duration("unlock-ttl"); ttl > 0 {
+				c.Cache = command.NewPasswordAgent(ttl)
+			}
+			vikingCli.Config = &c
+
+			vikingCli.StrictHostKeys = ctx.Bool("strict-host-keys")
+			vikingCli.SSHKnownHosts = ctx.Bool("ssh-known-hosts")
+			return nil
+		},
 		Commands: []*cli.Command{
 			// Often used commands
 			machine.NewExecuteCmd(vikingCli),
 			machine.NewCopyCmd(vikingCli),
+			machine.NewSSHCmd(vikingCli),
+			machine.NewTunnelCmd(vikingCli),
 
 			// Other commands
 			key.NewCmd(vikingCli),
 			machine.NewCmd(vikingCli),
+			hostkey.NewCmd(vikingCli),
+			profile.NewCmd(vikingCli),
 			cfg.NewConfigCmd(vikingCli),
 		},
 		Suggest:   true,
@@ -55,10 +103,22 @@ func main() {
 		Writer:    vikingCli.Out,
 		ErrWriter: vikingCli.Err,
 		ExitErrHandler: func(ctx *cli.Context, err error) {
-			if err != nil {
-				fmt.Fprintf(vikingCli.Err, "Error: %v\n", err)
-				os.Exit(0)
+			if err == nil {
+				return
 			}
+
+			code := 1
+
+			var exitErr cli.ExitCoder
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+
+			if msg := err.Error(); msg != "" {
+				fmt.Fprintf(vikingCli.Err, "Error: %s\n", msg)
+			}
+
+			os.Exit(code)
 		},
 	}
 
@@ -0,0 +1,342 @@
+// Package sshconfig reads and writes OpenSSH client configuration files.
+package sshconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth limits nested Include directives, like ssh does.
+const maxIncludeDepth = 16
+
+// Config is a parsed ssh_config file. Options are looked up for a host alias
+// the way ssh does: blocks are evaluated in order and the first value
+// obtained for an option is used.
+type Config struct {
+	blocks []*block
+}
+
+// block is a Host or Match block. Options before the first block are stored
+// in a block matching all hosts.
+type block struct {
+	id       int
+	patterns []string
+	// match marks Match blocks, which are not supported. They only apply
+	// when they are Match all.
+	match   bool
+	all     bool
+	options []option
+}
+
+type option struct {
+	key   string
+	value string
+}
+
+// ParseFile parses the ssh_config file at path and the files it includes.
+// Relative Include paths are resolved against ~/.ssh, like for the user
+// config of ssh.
+func ParseFile(path string) (*Config, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{
+		cfg:     &Config{},
+		baseDir: filepath.Join(home, ".ssh"),
+		home:    home,
+	}
+	p.cur = p.newBlock([]string{"*"}, false, true)
+
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+
+	return p.cfg, nil
+}
+
+type parser struct {
+	cfg     *Config
+	cur     *block
+	baseDir string
+	home    string
+	nextID  int
+}
+
+func (p *parser) newBlock(patterns []string, match, all bool) *block {
+	p.nextID++
+	b := &block{id: p.nextID, patterns: patterns, match: match, all: all}
+	p.cfg.blocks = append(p.cfg.blocks, b)
+
+	return b
+}
+
+// add appends an option to the current block. When blocks were added since
+// the current one started, e.g. by an included file, the options go to a
+// continuation of it so that the file order is kept.
+func (p *parser) add(key, value string) {
+	last := p.cfg.blocks[len(p.cfg.blocks)-1]
+	if last.id != p.cur.id {
+		last = &block{id: p.cur.id, patterns: p.cur.patterns, match: p.cur.match, all: p.cur.all}
+		p.cfg.blocks = append(p.cfg.blocks, last)
+	}
+
+	last.options = append(last.options, option{key: key, value: value})
+}
+
+func (p *parser) parseFile(path string, depth int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.parse(f, path, depth)
+}
+
+func (p *parser) parse(r io.Reader, name string, depth int) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		key, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", name, n, err)
+		}
+
+		if key == "" {
+			continue
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("%s line %d: missing argument for %s", name, n, key)
+		}
+
+		switch key {
+		case "host":
+			p.cur = p.newBlock(args, false, false)
+		case "match":
+			p.cur = p.newBlock(nil, true, len(args) == 1 && strings.EqualFold(args[0], "all"))
+		case "include":
+			if depth >= maxIncludeDepth {
+				return fmt.Errorf("%s line %d: too many nested includes", name, n)
+			}
+
+			if err := p.include(args, depth+1); err != nil {
+				return fmt.Errorf("%s line %d: %w", name, n, err)
+			}
+		default:
+			p.add(key, strings.Join(args, " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// include parses the files matching the given patterns as part of the
+// current block.
+func (p *parser) include(patterns []string, depth int) error {
+	cur := p.cur
+	defer func() { p.cur = cur }()
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "~/") {
+			pattern = filepath.Join(p.home, pattern[2:])
+		} else if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(p.baseDir, pattern)
+		}
+
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid Include pattern %q: %w", pattern, err)
+		}
+
+		for _, path := range paths {
+			if err := p.parseFile(path, depth); err != nil {
+				return err
+			}
+
+			p.cur = cur
+		}
+	}
+
+	return nil
+}
+
+// splitLine splits a config line into its lowercased keyword and arguments.
+// Arguments may be quoted, the keyword may be separated by "=".
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", nil, nil
+	}
+
+	i := strings.IndexAny(line, " \t=")
+	if i == -1 {
+		return strings.ToLower(line), nil, nil
+	}
+
+	key := strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '#' {
+			break
+		}
+
+		var arg string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				return "", nil, errors.New("unterminated quote")
+			}
+
+			arg, rest = rest[1:end+1], rest[end+2:]
+		} else if end := strings.IndexAny(rest, " \t"); end == -1 {
+			arg, rest = rest, ""
+		} else {
+			arg, rest = rest[:end], rest[end:]
+		}
+
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+
+	return key, args, nil
+}
+
+// Hosts returns the aliases of the Host blocks that do not contain
+// wildcards or negations, in the order they appear.
+func (c *Config) Hosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+
+	for _, b := range c.blocks {
+		if b.match || b.all {
+			continue
+		}
+
+		for _, pattern := range b.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+
+			seen[pattern] = true
+			hosts = append(hosts, pattern)
+		}
+	}
+
+	return hosts
+}
+
+// Get returns the first value of the option key for the host alias, or ""
+// if it is not set.
+func (c *Config) Get(alias, key string) string {
+	if values := c.values(alias, key, true); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// GetAll returns all values of the option key for the host alias, for
+// options that can be given several times such as IdentityFile.
+func (c *Config) GetAll(alias, key string) []string {
+	return c.values(alias, key, false)
+}
+
+func (c *Config) values(alias, key string, first bool) []string {
+	key = strings.ToLower(key)
+
+	var values []string
+	for _, b := range c.blocks {
+		if !b.matches(alias) {
+			continue
+		}
+
+		for _, o := range b.options {
+			if o.key != key {
+				continue
+			}
+
+			values = append(values, o.value)
+			if first {
+				return values
+			}
+		}
+	}
+
+	return values
+}
+
+func (b *block) matches(alias string) bool {
+	if b.match {
+		return b.all
+	}
+
+	if b.all {
+		return true
+	}
+
+	alias = strings.ToLower(alias)
+
+	matched := false
+	for _, pattern := range b.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "!"))
+
+		if !matchPattern(pattern, alias) {
+			continue
+		}
+
+		if negated {
+			return false
+		}
+
+		matched = true
+	}
+
+	return matched
+}
+
+// matchPattern reports whether name matches pattern, where "*" matches any
+// sequence of characters and "?" a single character.
+func matchPattern(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+
+			for i := 0; i <= len(name); i++ {
+				if matchPattern(pattern, name[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || pattern[0] != name[0] {
+				return false
+			}
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return name == ""
+}
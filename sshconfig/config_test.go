@@ -0,0 +1,277 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// parseFiles writes files to a temporary home directory, paths being relative
+// to it, and parses the first one.
+func parseFiles(t *testing.T, files ...[2]string) *Config {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	for _, f := range files {
+		path := filepath.Join(home, f[0])
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(f[1]), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := ParseFile(filepath.Join(home, files[0][0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// lookup is an expected value of Get.
+type lookup struct {
+	alias, key, want string
+}
+
+func checkLookups(t *testing.T, cfg *Config, lookups []lookup) {
+	t.Helper()
+
+	for _, l := range lookups {
+		if got := cfg.Get(l.alias, l.key); got != l.want {
+			t.Errorf("Get(%q, %q) = %q, want %q", l.alias, l.key, got, l.want)
+		}
+	}
+}
+
+func TestFirstMatchWins(t *testing.T) {
+	cfg := parseFiles(t, [2]string{".ssh/config", `
+# Options before the first block apply to all hosts.
+User global
+
+Host web
+    HostName 10.0.0.1
+    User deploy
+    Port 2222
+
+Host web db
+    HostName 10.0.0.99
+    Port 2200
+
+Host *
+    User fallback
+    Port 22
+    IdentityFile ~/.ssh/id_default
+`})
+
+	checkLookups(t, cfg, []lookup{
+		{"web", "HostName", "10.0.0.1"},
+		{"web", "User", "global"},
+		{"web", "Port", "2222"},
+		{"db", "HostName", "10.0.0.99"},
+		{"db", "Port", "2200"},
+		{"db", "User", "global"},
+		{"cache", "HostName", ""},
+		{"cache", "Port", "22"},
+		// Keywords are case insensitive.
+		{"web", "hostname", "10.0.0.1"},
+		{"web", "HOSTNAME", "10.0.0.1"},
+	})
+}
+
+func TestGetAll(t *testing.T) {
+	cfg := parseFiles(t, [2]string{".ssh/config", `
+Host web
+    IdentityFile ~/.ssh/id_web
+Host *
+    IdentityFile ~/.ssh/id_default
+`})
+
+	want := []string{"~/.ssh/id_web", "~/.ssh/id_default"}
+	if got := cfg.GetAll("web", "IdentityFile"); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll(web, IdentityFile) = %q, want %q", got, want)
+	}
+}
+
+func TestWildcardHosts(t *testing.T) {
+	cfg := parseFiles(t, [2]string{".ssh/config", `
+Host web-? !web-9
+    User web
+
+Host *.example.com
+    User example
+
+Host db-*
+    User db
+
+Host WEB-1 db-1 *.example.com
+    Port 2222
+
+Match host foo
+    User match
+
+Match all
+    User all
+`})
+
+	checkLookups(t, cfg, []lookup{
+		{"web-1", "User", "web"},
+		// Negated patterns exclude hosts matching the other patterns.
+		{"web-9", "User", "all"},
+		// ? matches exactly one character.
+		{"web-10", "User", "all"},
+		{"a.example.com", "User", "example"},
+		{"example.com", "User", "all"},
+		{"db-1", "User", "db"},
+		{"db-", "User", "db"},
+		// Patterns are case insensitive.
+		{"web-1", "Port", "2222"},
+		{"b.example.com", "Port", "2222"},
+		{"db-2", "Port", ""},
+		// Match blocks other than Match all are not supported.
+		{"foo", "User", "all"},
+	})
+
+	want := []string{"WEB-1", "db-1"}
+	if got := cfg.Hosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Hosts() = %q, want %q", got, want)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	cfg := parseFiles(t,
+		[2]string{".ssh/config", `
+Include config.d/*.conf
+
+Host web
+    Include web.conf
+    Port 2222
+
+Host db
+    HostName 10.0.1.1
+
+Include ~/other/extra
+`},
+		[2]string{".ssh/config.d/1-bastion.conf", `
+Host bastion
+    HostName 10.0.0.254
+    User jump
+`},
+		[2]string{".ssh/config.d/2-db.conf", `
+Host db
+    HostName 10.0.1.2
+    User dba
+`},
+		[2]string{".ssh/config.d/ignored", `
+Host ignored
+    HostName 10.0.0.253
+`},
+		// Included inside the web block, the Host line starts a new block.
+		[2]string{".ssh/web.conf", `
+HostName 10.0.0.1
+User deploy
+Host cache
+    HostName 10.0.2.1
+`},
+		[2]string{"other/extra", `
+Host *
+    User extra
+`},
+	)
+
+	checkLookups(t, cfg, []lookup{
+		{"bastion", "HostName", "10.0.0.254"},
+		{"bastion", "User", "jump"},
+		// The included file comes first.
+		{"db", "HostName", "10.0.1.2"},
+		{"db", "User", "dba"},
+		{"web", "HostName", "10.0.0.1"},
+		{"web", "User", "deploy"},
+		// Options after an Include belong to the block of the Include.
+		{"web", "Port", "2222"},
+		{"cache", "HostName", "10.0.2.1"},
+		{"cache", "Port", ""},
+		{"cache", "User", "extra"},
+		{"ignored", "HostName", ""},
+	})
+
+	want := []string{"bastion", "db", "web", "cache"}
+	if got := cfg.Hosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Hosts() = %q, want %q", got, want)
+	}
+}
+
+func TestIncludeLoop(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	path := filepath.Join(home, ".ssh", "config")
+	os.MkdirAll(filepath.Dir(path), 0o700)
+	os.WriteFile(path, []byte("Include config\n"), 0o600)
+
+	if _, err := ParseFile(path); err == nil {
+		t.Error("ParseFile of a config including itself succeeded")
+	}
+}
+
+func TestProxyJump(t *testing.T) {
+	cfg := parseFiles(t, [2]string{".ssh/config", `
+Host app
+    ProxyJump gateway,ops@bastion:2222
+
+Host bastion
+    ProxyJump gateway
+
+Host direct
+    ProxyJump none
+
+Host *
+    ProxyJump default
+`})
+
+	checkLookups(t, cfg, []lookup{
+		{"app", "ProxyJump", "gateway,ops@bastion:2222"},
+		{"bastion", "ProxyJump", "gateway"},
+		{"direct", "ProxyJump", "none"},
+		{"other", "ProxyJump", "default"},
+	})
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		args []string
+	}{
+		{"", "", nil},
+		{"  # comment", "", nil},
+		{"HostName 10.0.0.1", "hostname", []string{"10.0.0.1"}},
+		{"\tPort\t2222  ", "port", []string{"2222"}},
+		{"Port=2222", "port", []string{"2222"}},
+		{"Port = 2222", "port", []string{"2222"}},
+		{"Host web db", "host", []string{"web", "db"}},
+		{`IdentityFile "~/my keys/id"`, "identityfile", []string{"~/my keys/id"}},
+		{"User deploy # comment", "user", []string{"deploy"}},
+	}
+
+	for _, tt := range tests {
+		key, args, err := splitLine(tt.line)
+		if err != nil {
+			t.Errorf("splitLine(%q): %v", tt.line, err)
+			continue
+		}
+
+		if key != tt.key || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("splitLine(%q) = %q, %q, want %q, %q", tt.line, key, args, tt.key, tt.args)
+		}
+	}
+
+	if _, _, err := splitLine(`IdentityFile "~/id`); err == nil {
+		t.Error("splitLine with an unterminated quote succeeded")
+	}
+}
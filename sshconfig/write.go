@@ -0,0 +1,67 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Host is a Host block written by Write.
+type Host struct {
+	Alias        string
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+	ProxyJump    string
+	// Comment is written above the block, one comment line per line.
+	Comment string
+}
+
+// Write writes hosts as Host blocks in the ssh_config format.
+func Write(w io.Writer, hosts []Host) error {
+	bw := bufio.NewWriter(w)
+
+	for i, host := range hosts {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+
+		if host.Comment != "" {
+			for _, line := range strings.Split(host.Comment, "\n") {
+				fmt.Fprintf(bw, "# %s\n", line)
+			}
+		}
+
+		fmt.Fprintf(bw, "Host %s\n", quote(host.Alias))
+		writeOption(bw, "HostName", host.HostName)
+		writeOption(bw, "User", host.User)
+		if host.Port != 0 && host.Port != 22 {
+			writeOption(bw, "Port", strconv.Itoa(host.Port))
+		}
+		if host.IdentityFile != "" {
+			writeOption(bw, "IdentityFile", host.IdentityFile)
+			writeOption(bw, "IdentitiesOnly", "yes")
+		}
+		writeOption(bw, "ProxyJump", host.ProxyJump)
+	}
+
+	return bw.Flush()
+}
+
+func writeOption(w io.Writer, key, value string) {
+	if value != "" {
+		fmt.Fprintf(w, "    %s %s\n", key, quote(value))
+	}
+}
+
+// quote encloses values containing whitespace in double quotes.
+func quote(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+
+	return value
+}
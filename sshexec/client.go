@@ -1,6 +1,7 @@
 package sshexec
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -11,12 +12,37 @@ import (
 	"golang.org/x/crypto/ssh/agent"
 )
 
-func SshClient(host string, port int, user, private, passphrase string) (*ssh.Client, error) {
+// ClientConfig describes how to reach and authenticate against a single host.
+type ClientConfig struct {
+	Host       string
+	Port       int
+	User       string
+	Private    string
+	Passphrase string
+
+	// HostKeyCallback verifies the key presented by the server. Connections
+	// are refused when it is not set.
+	HostKeyCallback ssh.HostKeyCallback
+	// HostKeyAlgorithms restricts the host key algorithms accepted from the
+	// server. It is usually filled with the types of the already known keys.
+	HostKeyAlgorithms []string
+
+	// Jump is the jump host used to reach the host. The host is dialed
+	// directly when it is nil.
+	Jump *JumpHost
+}
+
+// Addr returns the host and port in the form accepted by net.Dial.
+func (c ClientConfig) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+func SshClient(cfg ClientConfig) (*ssh.Client, error) {
 	var sshAuth ssh.AuthMethod
 	var err error
 
-	if private != "" {
-		sshAuth, err = authorizeWithKey(private, passphrase)
+	if cfg.Private != "" {
+		sshAuth, err = authorizeWithKey(cfg.Private, cfg.Passphrase)
 	} else {
 		sshAuth, err = authorizeWithSSHAgent()
 	}
@@ -26,17 +52,48 @@ func SshClient(host string, port int, user, private, passphrase string) (*ssh.Cl
 
 	// Set up SSH client configuration
 	config := &ssh.ClientConfig{
-		User: user,
+		User: cfg.User,
 		Auth: []ssh.AuthMethod{
 			sshAuth,
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Second * 5,
+		HostKeyCallback:   cfg.HostKeyCallback,
+		HostKeyAlgorithms: cfg.HostKeyAlgorithms,
+		Timeout:           time.Second * 5,
 	}
 
-	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return dialClient(cfg, config)
+}
+
+var errHostKeyScanned = errors.New("host key scanned")
+
+// ScanHostKey connects to the host and returns the key it presents, without
+// authenticating.
+func ScanHostKey(cfg ClientConfig) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+
+	config := &ssh.ClientConfig{
+		User: cfg.User,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyScanned
+		},
+		HostKeyAlgorithms: cfg.HostKeyAlgorithms,
+		Timeout:           time.Second * 5,
+	}
+
+	client, err := dialClient(cfg, config)
+	if err == nil {
+		client.Close()
+	}
+
+	if hostKey == nil {
+		if err == nil {
+			err = errors.New("server did not present a host key")
+		}
+		return nil, fmt.Errorf("failed to scan host key of %s: %w", cfg.Host, err)
+	}
 
-	return ssh.Dial("tcp", addr, config)
+	return hostKey, nil
 }
 
 func authorizeWithKey(key, passphrase string) (ssh.AuthMethod, error) {
@@ -2,13 +2,20 @@ package sshexec
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
+// DefaultWaitDelay is the default value of Cmd.WaitDelay.
+const DefaultWaitDelay = 2 * time.Second
+
 type Cmd struct {
 	Executor
 
@@ -16,6 +23,13 @@ type Cmd struct {
 	Args           []string
 	Stdin          io.Reader
 	Stdout, Stderr io.Writer
+
+	// WaitDelay is how long to wait for the command to exit after it was
+	// signaled because its context is done, before closing the connection.
+	WaitDelay time.Duration
+
+	ctx  context.Context
+	done chan struct{}
 }
 
 func Command(exec Executor, name string, args ...string) *Cmd {
@@ -26,15 +40,91 @@ func Command(exec Executor, name string, args ...string) *Cmd {
 	}
 }
 
+// CommandContext is like Command but includes a context. When the context is
+// done before the command completes, the command is sent SIGTERM, or the
+// signal of an InterruptError cause, and the connection is closed if it did
+// not exit after WaitDelay. Wait then returns the cause of the context.
+func CommandContext(ctx context.Context, exec Executor, name string, args ...string) *Cmd {
+	cmd := Command(exec, name, args...)
+	cmd.ctx = ctx
+	cmd.WaitDelay = DefaultWaitDelay
+
+	return cmd
+}
+
 func (c *Cmd) Start() error {
-	return c.Executor.Start(c.argv(), c.Stdin, c.Stdout, c.Stderr)
+	return c.start(func() error {
+		return c.Executor.Start(c.argv(), c.Stdin, c.Stdout, c.Stderr)
+	})
+}
+
+func (c *Cmd) start(start func() error) error {
+	if c.ctx == nil {
+		return start()
+	}
+
+	if c.ctx.Err() != nil {
+		return context.Cause(c.ctx)
+	}
+
+	if err := start(); err != nil {
+		return err
+	}
+
+	c.done = make(chan struct{})
+	go c.watch(c.done)
+
+	return nil
+}
+
+// watch stops the command when its context is done.
+func (c *Cmd) watch(done chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-c.ctx.Done():
+	}
+
+	sig := ssh.SIGTERM
+
+	var interrupt *InterruptError
+	if errors.As(context.Cause(c.ctx), &interrupt) {
+		sig = interrupt.Signal
+	}
+
+	_ = c.Executor.Signal(sig)
+
+	timer := time.NewTimer(c.WaitDelay)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		_ = c.Executor.Close()
+	}
+}
+
+func (c *Cmd) Wait() error {
+	err := c.Executor.Wait()
+
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+
+		if err != nil && c.ctx.Err() != nil {
+			return context.Cause(c.ctx)
+		}
+	}
+
+	return err
 }
 
 func (c *Cmd) Run() error {
-	var b bytes.Buffer
+	var b *bytes.Buffer
 
 	if c.Stderr == nil {
-		c.Stderr = &b
+		b = new(bytes.Buffer)
+		c.Stderr = b
 	}
 
 	if err := c.Start(); err != nil {
@@ -42,7 +132,11 @@ func (c *Cmd) Run() error {
 	}
 
 	if err := c.Wait(); err != nil {
-		return fmt.Errorf("%w.\n%s", err, b.String())
+		if b != nil && b.Len() > 0 {
+			return fmt.Errorf("%w.\n%s", err, b.String())
+		}
+
+		return err
 	}
 
 	return nil
@@ -53,7 +147,10 @@ func (c *Cmd) RunInteractive(in io.Reader, out, stderr io.Writer, w, h int) erro
 		c.Stderr = stderr
 	}
 
-	if err := c.StartInteractive(c.argv(), in, out, stderr, w, h); err != nil {
+	err := c.start(func() error {
+		return c.StartInteractive(c.argv(), in, out, stderr, w, h)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -110,6 +207,17 @@ func (c *Cmd) String() string {
 	return c.argv()
 }
 
+// InterruptError is the cause of a context canceled because viking received
+// a signal. Commands run with such a context forward the signal to the
+// remote command.
+type InterruptError struct {
+	Signal ssh.Signal
+}
+
+func (e *InterruptError) Error() string {
+	return fmt.Sprintf("interrupted by SIG%s", e.Signal)
+}
+
 type ExitError struct {
 	Content string
 	Status  int
@@ -0,0 +1,107 @@
+package sshexec
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// escapeChar starts escape sequences, like in ssh.
+const escapeChar = '~'
+
+const escapeHelp = "Supported escape sequences:\r\n" +
+	" ~.   - terminate connection\r\n" +
+	" ~?   - this message\r\n" +
+	" ~~   - send the escape character by typing it twice\r\n" +
+	"(Note that escapes are only recognized immediately after newline.)\r\n"
+
+// EscapeReader reads the input of an interactive session and handles the
+// escape sequences of ssh typed at the beginning of a line: "~." calls
+// disconnect, "~?" prints the supported sequences to out and "~~" sends "~".
+type EscapeReader struct {
+	r          io.Reader
+	out        io.Writer
+	disconnect func()
+
+	lineStart    bool
+	escaped      bool
+	disconnected atomic.Bool
+
+	buf     []byte
+	pending []byte
+	err     error
+}
+
+func NewEscapeReader(r io.Reader, out io.Writer, disconnect func()) *EscapeReader {
+	return &EscapeReader{
+		r:          r,
+		out:        out,
+		disconnect: disconnect,
+		lineStart:  true,
+	}
+}
+
+// Disconnected reports whether the user disconnected with "~.".
+func (e *EscapeReader) Disconnected() bool {
+	return e.disconnected.Load()
+}
+
+func (e *EscapeReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.err != nil || e.Disconnected() {
+			return 0, e.readErr()
+		}
+
+		if len(e.buf) < len(p) {
+			e.buf = make([]byte, len(p))
+		}
+
+		n, err := e.r.Read(e.buf[:len(p)])
+		e.err = err
+		e.filter(e.buf[:n])
+	}
+
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+
+	return n, nil
+}
+
+func (e *EscapeReader) readErr() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	return io.EOF
+}
+
+// filter appends the input in b to the pending data, handling escape
+// sequences.
+func (e *EscapeReader) filter(b []byte) {
+	for _, c := range b {
+		if e.escaped {
+			e.escaped = false
+
+			switch c {
+			case '.':
+				e.disconnected.Store(true)
+				e.disconnect()
+				return
+			case '?':
+				fmt.Fprint(e.out, escapeHelp)
+				continue
+			case escapeChar:
+				e.pending = append(e.pending, c)
+			default:
+				e.pending = append(e.pending, escapeChar, c)
+			}
+		} else if c == escapeChar && e.lineStart {
+			e.escaped = true
+			continue
+		} else {
+			e.pending = append(e.pending, c)
+		}
+
+		e.lineStart = c == '\r' || c == '\n'
+	}
+}
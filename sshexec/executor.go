@@ -5,45 +5,88 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
 
 	"golang.org/x/crypto/ssh"
 )
 
 type Executor interface {
+	// Start starts cmd, which must not be empty.
 	Start(cmd string, in io.Reader, out, stderr io.Writer) error
+	// StartInteractive starts cmd with a pseudo-terminal of w by h. An empty
+	// cmd starts the login shell of the user.
 	StartInteractive(cmd string, in io.Reader, out, stderr io.Writer, w, h int) error
 	Wait() error
+	// Connect opens the SSH connection if it is not open yet. Commands
+	// connect on demand, but connecting up front lets callers handle
+	// prompts, such as unknown host keys, before taking over the terminal.
+	Connect() error
+	// Setenv sets an environment variable for the commands started
+	// afterwards. Servers may refuse to set it. TERM is used as terminal type
+	// of interactive commands.
+	Setenv(name, value string)
+	// WindowChange tells the running interactive command that the size of
+	// the terminal changed.
+	WindowChange(w, h int) error
+	// Signal sends sig to the running command. Servers that do not support
+	// signals ignore it.
+	Signal(sig ssh.Signal) error
+	// Close closes the connection. It may be called while a command is
+	// running, which makes Wait return.
 	Close() error
 	Addr() string
 	SetLogger(logger *slog.Logger)
 }
 
-// executor allows for the execution of multiple commands, but only one at a time. It is not safe for concurrent use.
+// executor allows for the execution of multiple commands, but only one at a time. It is not safe for concurrent use,
+// except for Signal and Close.
 type executor struct {
-	host       string
-	port       int
-	user       string
-	private    string
-	passphrase string
+	cfg ClientConfig
 
 	logger *slog.Logger
+	env    [][2]string
 
+	mu      sync.Mutex
 	session *ssh.Session
 	client  *ssh.Client
 }
 
-func NewExecutor(host string, port int, user, private, passphrase string) Executor {
+func NewExecutor(cfg ClientConfig) Executor {
 	return &executor{
-		host:       host,
-		port:       port,
-		user:       user,
-		private:    private,
-		passphrase: passphrase,
+		cfg: cfg,
 	}
 }
 
 func (e *executor) Addr() string {
-	return e.host
+	return e.cfg.Host
+}
+
+func (e *executor) Connect() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.client != nil {
+		return nil
+	}
+
+	client, err := SshClient(e.cfg)
+	if err != nil {
+		return err
+	}
+
+	e.client = client
+	return nil
+}
+
+func (e *executor) Setenv(name, value string) {
+	for i, kv := range e.env {
+		if kv[0] == name {
+			e.env[i][1] = value
+			return
+		}
+	}
+
+	e.env = append(e.env, [2]string{name, value})
 }
 
 func (e *executor) Start(cmd string, in io.Reader, out, stderr io.Writer) error {
@@ -65,17 +108,24 @@ type ptyOptions struct {
 }
 
 func (e *executor) startSession(cmd string, in io.Reader, out, outErr io.Writer, pty *ptyOptions) error {
+	// A login shell without a terminal would wait for input forever.
+	if cmd == "" && pty == nil {
+		return errors.New("command is required")
+	}
+
+	if err := e.Connect(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	if e.session != nil {
 		return errors.New("another command is currently running")
 	}
 
 	if e.client == nil {
-		client, err := SshClient(e.host, e.port, e.user, e.private, e.passphrase)
-		if err != nil {
-			return err
-		}
-
-		e.client = client
+		return errors.New("connection closed")
 	}
 
 	session, err := e.client.NewSession()
@@ -87,8 +137,21 @@ func (e *executor) startSession(cmd string, in io.Reader, out, outErr io.Writer,
 	session.Stdout = out
 	session.Stderr = outErr
 
+	term := "xterm-256color"
+	for _, kv := range e.env {
+		if kv[0] == "TERM" {
+			term = kv[1]
+			continue
+		}
+
+		// Like ssh, carry on when the server refuses the variable.
+		if err := session.Setenv(kv[0], kv[1]); err != nil && e.logger != nil {
+			e.logger.Warn("server refused environment variable", "host", e.cfg.Host, "name", kv[0])
+		}
+	}
+
 	if pty != nil {
-		if err := session.RequestPty("xterm-256color", pty.h, pty.w, pty.modes); err != nil {
+		if err := session.RequestPty(term, pty.h, pty.w, pty.modes); err != nil {
 			_ = session.Close()
 			return err
 		}
@@ -97,11 +160,18 @@ func (e *executor) startSession(cmd string, in io.Reader, out, outErr io.Writer,
 	e.session = session
 
 	if e.logger != nil {
-		e.logger.Info("starting command", "host", e.host, "cmd", cmd)
+		e.logger.Info("starting command", "host", e.cfg.Host, "cmd", cmd)
 	}
 
-	if err := session.Start(cmd); err != nil {
-		_ = e.closeSession()
+	start := session.Start
+	if cmd == "" {
+		// Without a command, the login shell of the user is started. Only
+		// interactive sessions get here.
+		start = func(string) error { return session.Shell() }
+	}
+
+	if err := start(cmd); err != nil {
+		_ = e.closeSessionLocked()
 		return fmt.Errorf("failed to start ssh session: %w", err)
 	}
 
@@ -109,12 +179,16 @@ func (e *executor) startSession(cmd string, in io.Reader, out, outErr io.Writer,
 }
 
 func (e *executor) Wait() error {
-	if e.session == nil {
+	e.mu.Lock()
+	session := e.session
+	e.mu.Unlock()
+
+	if session == nil {
 		return errors.New("failed to wait command: command not started")
 	}
 	defer e.closeSession()
 
-	if err := e.session.Wait(); err != nil {
+	if err := session.Wait(); err != nil {
 		if exitErr, ok := err.(*ssh.ExitError); ok {
 			return &ExitError{
 				Status:  exitErr.ExitStatus(),
@@ -132,24 +206,58 @@ func (e *executor) SetLogger(logger *slog.Logger) {
 	e.logger = logger
 }
 
+func (e *executor) WindowChange(w, h int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return errors.New("failed to change window size: command not started")
+	}
+
+	return e.session.WindowChange(h, w)
+}
+
+func (e *executor) Signal(sig ssh.Signal) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return errors.New("failed to send signal: command not started")
+	}
+
+	return e.session.Signal(sig)
+}
+
 func (e *executor) Close() error {
-	if err := e.closeSession(); err != nil {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.closeSessionLocked(); err != nil {
 		return err
 	}
 
 	if e.client != nil {
-		return e.client.Close()
+		err := e.client.Close()
+		e.client = nil
+		return err
 	}
 
 	return nil
 }
 
 func (e *executor) closeSession() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.closeSessionLocked()
+}
+
+func (e *executor) closeSessionLocked() error {
 	if e.session != nil {
 		if err := e.session.Close(); err != nil {
 			if err != io.EOF {
 				if e.logger != nil {
-					e.logger.Error("failed to close SSH session", "host", e.host, "err", err)
+					e.logger.Error("failed to close SSH session", "host", e.cfg.Host, "err", err)
 				}
 
 				return err
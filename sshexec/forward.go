@@ -0,0 +1,139 @@
+package sshexec
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ForwardKind is the kind of a port forward.
+type ForwardKind int
+
+const (
+	// ForwardLocal listens locally and forwards connections to the target
+	// through the host, like ssh -L.
+	ForwardLocal ForwardKind = iota
+	// ForwardRemote listens on the host and forwards connections to the
+	// target through viking, like ssh -R.
+	ForwardRemote
+	// ForwardDynamic runs a local SOCKS5 proxy connecting through the host,
+	// like ssh -D.
+	ForwardDynamic
+)
+
+func (k ForwardKind) String() string {
+	switch k {
+	case ForwardLocal:
+		return "local"
+	case ForwardRemote:
+		return "remote"
+	case ForwardDynamic:
+		return "dynamic"
+	}
+
+	return fmt.Sprintf("ForwardKind(%d)", int(k))
+}
+
+// Forward is a port forward of a tunnel.
+type Forward struct {
+	Kind ForwardKind
+	// Listen is the address listened on, locally for local and dynamic
+	// forwards and on the host for remote forwards.
+	Listen string
+	// Target is the address connections are forwarded to. It is empty for
+	// dynamic forwards.
+	Target string
+}
+
+func (f Forward) String() string {
+	if f.Kind == ForwardDynamic {
+		return fmt.Sprintf("%s (SOCKS5)", f.Listen)
+	}
+
+	return fmt.Sprintf("%s -> %s", f.Listen, f.Target)
+}
+
+// ParseForward parses a forward in the format used by ssh:
+// [BIND_ADDRESS:]PORT:HOST:HOSTPORT for local and remote forwards, and
+// [BIND_ADDRESS:]PORT for dynamic forwards. IPv6 addresses must be enclosed in
+// square brackets. The bind address defaults to localhost.
+func ParseForward(kind ForwardKind, spec string) (Forward, error) {
+	f := Forward{Kind: kind}
+
+	parts, err := splitForward(spec)
+	if err != nil {
+		return f, fmt.Errorf("invalid %s forward %q: %w", kind, spec, err)
+	}
+
+	want := 2
+	if kind == ForwardDynamic {
+		want = 0
+	}
+
+	// The bind address is optional.
+	if len(parts) == want+1 {
+		parts = append([]string{"localhost"}, parts...)
+	}
+
+	if len(parts) != want+2 {
+		return f, fmt.Errorf("invalid %s forward %q", kind, spec)
+	}
+
+	if parts[0] == "" || parts[0] == "*" {
+		parts[0] = "0.0.0.0"
+	}
+
+	if f.Listen, err = joinForward(parts[0], parts[1]); err != nil {
+		return f, fmt.Errorf("invalid %s forward %q: %w", kind, spec, err)
+	}
+
+	if kind != ForwardDynamic {
+		if f.Target, err = joinForward(parts[2], parts[3]); err != nil {
+			return f, fmt.Errorf("invalid %s forward %q: %w", kind, spec, err)
+		}
+	}
+
+	return f, nil
+}
+
+// splitForward splits spec at colons that are not enclosed in square
+// brackets, and removes the brackets.
+func splitForward(spec string) ([]string, error) {
+	var parts []string
+	var part strings.Builder
+
+	bracket := false
+	for _, r := range spec {
+		switch {
+		case r == '[' && !bracket && part.Len() == 0:
+			bracket = true
+		case r == ']' && bracket:
+			bracket = false
+		case r == ':' && !bracket:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+
+	if bracket {
+		return nil, fmt.Errorf("missing ]")
+	}
+
+	return append(parts, part.String()), nil
+}
+
+func joinForward(host, port string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("missing host")
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,320 @@
+package sshexec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPrompt asks whether an unknown host key should be trusted.
+type HostKeyPrompt func(host string, key ssh.PublicKey) (bool, error)
+
+// UnknownHostKeyError is returned when a host presents a key that is not
+// known and it was not accepted.
+type UnknownHostKeyError struct {
+	Host string
+	Key  ssh.PublicKey
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("host key verification failed: unknown %s key %s for %s",
+		e.Key.Type(), ssh.FingerprintSHA256(e.Key), e.Host)
+}
+
+// HostKeyChangedError is returned when a host presents a key different from
+// the one that was pinned for it.
+type HostKeyChangedError struct {
+	Host string
+	Key  ssh.PublicKey
+	Want []knownhosts.KnownKey
+}
+
+func (e *HostKeyChangedError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "host key verification failed: the host key for %s has changed, someone could be eavesdropping on you.\n", e.Host)
+	fmt.Fprintf(&sb, "The server presented %s key %s.", e.Key.Type(), ssh.FingerprintSHA256(e.Key))
+	for _, want := range e.Want {
+		fmt.Fprintf(&sb, "\nExpected %s key %s (%s:%d).", want.Key.Type(), ssh.FingerprintSHA256(want.Key), want.Filename, want.Line)
+	}
+
+	return sb.String()
+}
+
+// KnownHost is a single entry of a known_hosts file.
+type KnownHost struct {
+	Hosts []string
+	Key   ssh.PublicKey
+}
+
+// HostKeyStore verifies host keys against known_hosts files. New keys are
+// only ever written to File, additional files are read-only. It is safe for
+// concurrent use; prompts are serialized.
+type HostKeyStore struct {
+	// File is the known_hosts file managed by viking.
+	File string
+	// Extra are read-only known_hosts files, e.g. ~/.ssh/known_hosts.
+	Extra []string
+	// Strict refuses unknown host keys instead of prompting.
+	Strict bool
+	// Prompt is called for unknown host keys. Unknown keys are refused when
+	// it is nil.
+	Prompt HostKeyPrompt
+
+	mu sync.Mutex
+}
+
+func NewHostKeyStore(file string, extra ...string) *HostKeyStore {
+	return &HostKeyStore{
+		File:  file,
+		Extra: extra,
+	}
+}
+
+// Callback returns a host key callback for use in ClientConfig.
+func (s *HostKeyStore) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		check, err := s.load()
+		if err != nil {
+			return err
+		}
+
+		err = check(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			return &HostKeyChangedError{Host: hostname, Key: key, Want: keyErr.Want}
+		}
+
+		if s.Strict || s.Prompt == nil {
+			return &UnknownHostKeyError{Host: hostname, Key: key}
+		}
+
+		ok, err := s.Prompt(hostname, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &UnknownHostKeyError{Host: hostname, Key: key}
+		}
+
+		return s.appendLine(knownhosts.Line([]string{hostname}, key))
+	}
+}
+
+// Algorithms returns the host key algorithms matching the keys known for
+// addr, so that the server is asked for a key we can verify. It returns nil
+// when no key is known.
+func (s *HostKeyStore) Algorithms(addr string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check, err := s.load()
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(addr, placeholderAddr, placeholderKey{}), &keyErr) {
+		return nil
+	}
+
+	var algos []string
+	for _, want := range keyErr.Want {
+		switch typ := want.Key.Type(); typ {
+		case ssh.KeyAlgoRSA:
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algos = append(algos, typ)
+		}
+	}
+
+	return algos
+}
+
+// List returns the entries of the viking managed known_hosts file.
+func (s *HostKeyStore) List() ([]KnownHost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []KnownHost
+	for len(data) > 0 {
+		var h KnownHost
+		var marker string
+
+		marker, h.Hosts, h.Key, _, data, err = ssh.ParseKnownHosts(data)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if marker == "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts, nil
+}
+
+// Lookup returns the keys pinned for addr in the viking managed file.
+func (s *HostKeyStore) Lookup(addr string) ([]ssh.PublicKey, error) {
+	hosts, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := knownhosts.Normalize(addr)
+
+	var keys []ssh.PublicKey
+	for _, h := range hosts {
+		for _, host := range h.Hosts {
+			if host == entry {
+				keys = append(keys, h.Key)
+				break
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// Pin replaces all keys known for addr with key.
+func (s *HostKeyStore) Pin(addr string, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.remove(addr); err != nil {
+		return err
+	}
+
+	return s.appendLine(knownhosts.Line([]string{addr}, key))
+}
+
+// Forget removes all keys known for addr and returns how many were removed.
+func (s *HostKeyStore) Forget(addr string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(addr)
+}
+
+func (s *HostKeyStore) load() (ssh.HostKeyCallback, error) {
+	if err := s.ensureFile(); err != nil {
+		return nil, err
+	}
+
+	files := []string{s.File}
+	for _, f := range s.Extra {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+
+	return knownhosts.New(files...)
+}
+
+func (s *HostKeyStore) ensureFile() error {
+	if err := os.MkdirAll(filepath.Dir(s.File), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.File, os.O_CREATE|os.O_RDONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *HostKeyStore) read() ([]byte, error) {
+	data, err := os.ReadFile(s.File)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (s *HostKeyStore) appendLine(line string) error {
+	f, err := os.OpenFile(s.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+func (s *HostKeyStore) remove(addr string) (int, error) {
+	data, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+
+	entry := knownhosts.Normalize(addr)
+
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && containsHost(fields[0], entry) {
+			removed++
+			continue
+		}
+
+		kept.WriteString(line)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, os.WriteFile(s.File, kept.Bytes(), 0o600)
+}
+
+func containsHost(hosts, entry string) bool {
+	for _, h := range strings.Split(hosts, ",") {
+		if h == entry {
+			return true
+		}
+	}
+
+	return false
+}
+
+// placeholderKey never matches a known key. It is used to make knownhosts
+// report which keys it knows for a host.
+type placeholderKey struct{}
+
+func (placeholderKey) Type() string                            { return "viking-placeholder" }
+func (placeholderKey) Marshal() []byte                         { return []byte("viking-placeholder") }
+func (placeholderKey) Verify(_ []byte, _ *ssh.Signature) error { return errors.New("placeholder key") }
+
+var placeholderAddr = &net.TCPAddr{IP: net.IPv4zero}
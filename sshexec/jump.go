@@ -0,0 +1,175 @@
+package sshexec
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// JumpHost is an SSH connection used to reach hosts that are not directly
+// accessible, e.g. a bastion. It is dialed on first use and shared by all
+// clients connected through it. It stays open until Close is called, so
+// hosts connected one after another do not dial it again. Chained jumps are
+// expressed by setting Jump in its config. JumpHost is safe for concurrent
+// use.
+type JumpHost struct {
+	cfg ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+func NewJumpHost(cfg ClientConfig) *JumpHost {
+	return &JumpHost{
+		cfg: cfg,
+	}
+}
+
+// Addr returns the address of the jump host.
+func (j *JumpHost) Addr() string {
+	return j.cfg.Addr()
+}
+
+// dial opens a connection to addr through the jump host.
+func (j *JumpHost) dial(network, addr string) (net.Conn, error) {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil, fmt.Errorf("jump host %s: %w", j.cfg.Host, net.ErrClosed)
+	}
+
+	if j.client == nil {
+		client, err := SshClient(j.cfg)
+		if err != nil {
+			j.mu.Unlock()
+			return nil, fmt.Errorf("jump host %s: %w", j.cfg.Host, err)
+		}
+
+		j.client = client
+		go j.watch(client)
+	}
+	client := j.client
+	j.mu.Unlock()
+
+	conn, err := client.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", j.cfg.Host, err)
+	}
+
+	return conn, nil
+}
+
+// watch forgets the client once its connection is gone, so the next dial
+// connects again.
+func (j *JumpHost) watch(client *ssh.Client) {
+	_ = client.Wait()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.client == client {
+		j.client = nil
+	}
+}
+
+// Close closes the connection to the jump host, and then its own jump host.
+// The clients connected through it are disconnected. Close does nothing on a
+// nil JumpHost, so that the Jump of any ClientConfig can be closed.
+func (j *JumpHost) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	j.closed = true
+	client := j.client
+	j.client = nil
+	j.mu.Unlock()
+
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+
+	if jumpErr := j.cfg.Jump.Close(); err == nil {
+		err = jumpErr
+	}
+
+	return err
+}
+
+// dialClient connects to cfg, directly or through its jump host.
+func dialClient(cfg ClientConfig, config *ssh.ClientConfig) (*ssh.Client, error) {
+	addr := cfg.Addr()
+
+	if cfg.Jump == nil {
+		conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		c, chans, reqs, err := handshake(conn, addr, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return ssh.NewClient(c, chans, reqs), nil
+	}
+
+	conn, err := cfg.Jump.dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := handshake(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// handshake runs the SSH handshake on conn within config.Timeout, so that a
+// host accepting connections without answering does not block forever. Time
+// spent in the host key callback, which may prompt the user, is not counted.
+func handshake(conn net.Conn, addr string, config *ssh.ClientConfig) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+	if config.HostKeyCallback == nil {
+		return nil, nil, nil, fmt.Errorf("ssh handshake with %s: no host key callback, refusing to connect", addr)
+	}
+
+	if config.Timeout <= 0 {
+		return ssh.NewClientConn(conn, addr, config)
+	}
+
+	timer := time.AfterFunc(config.Timeout, func() {
+		conn.Close()
+	})
+
+	hostKeyCallback := config.HostKeyCallback
+	timed := *config
+	timed.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !timer.Stop() {
+			return fmt.Errorf("ssh handshake with %s timed out", addr)
+		}
+		defer timer.Reset(config.Timeout)
+
+		return hostKeyCallback(hostname, remote, key)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &timed)
+	if !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+
+		return nil, nil, nil, fmt.Errorf("ssh handshake with %s timed out", addr)
+	}
+
+	return c, chans, reqs, err
+}
@@ -0,0 +1,26 @@
+package sshexec
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHandshakeWithoutHostKeyCallback(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		client, server := net.Pipe()
+
+		_, _, _, err := handshake(client, "deathstar:22", &ssh.ClientConfig{
+			User:    "root",
+			Timeout: timeout,
+		})
+		if err == nil {
+			t.Errorf("handshake with timeout %v and no host key callback succeeded", timeout)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,308 @@
+package sshexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// keepAliveInterval is how often the connection of a tunnel is checked.
+	keepAliveInterval = 15 * time.Second
+	// maxReconnectDelay is the longest time waited between reconnections.
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Tunnel forwards ports through a host. It reconnects when the connection
+// drops; local listeners are kept open in the meantime.
+type Tunnel struct {
+	cfg      ClientConfig
+	forwards []Forward
+
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func NewTunnel(cfg ClientConfig, forwards ...Forward) *Tunnel {
+	return &Tunnel{
+		cfg:      cfg,
+		forwards: forwards,
+	}
+}
+
+func (t *Tunnel) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
+// Run opens the forwards and serves them until ctx is done. It returns an
+// error if a local port cannot be listened on or the first connection fails;
+// later connection failures are retried.
+func (t *Tunnel) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for _, f := range t.forwards {
+		if f.Kind == ForwardRemote {
+			continue
+		}
+
+		l, err := net.Listen("tcp", f.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", f.Listen, err)
+		}
+
+		go func() {
+			<-ctx.Done()
+			l.Close()
+		}()
+
+		wg.Add(1)
+		go func(f Forward) {
+			defer wg.Done()
+			t.serveLocal(l, f)
+		}(f)
+	}
+
+	client, err := SshClient(t.cfg)
+	if err != nil {
+		return err
+	}
+
+	delay := time.Second
+	for first := true; ; first = false {
+		start := time.Now()
+		t.setClient(client)
+
+		err := t.serve(ctx, client)
+
+		t.setClient(nil)
+		client.Close()
+
+		if err != nil {
+			if first {
+				return err
+			}
+
+			t.log("failed to restore forwards", "host", t.cfg.Addr(), "err", err)
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(start) > maxReconnectDelay {
+			delay = time.Second
+		}
+
+		for client = nil; client == nil; {
+			t.log("connection lost, reconnecting", "host", t.cfg.Addr(), "in", delay)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, maxReconnectDelay)
+
+			if client, err = SshClient(t.cfg); err != nil {
+				t.log("failed to reconnect", "host", t.cfg.Addr(), "err", err)
+			}
+		}
+
+		t.log("reconnected", "host", t.cfg.Addr())
+	}
+}
+
+// serve opens the remote forwards on client and waits until the connection
+// drops or ctx is done.
+func (t *Tunnel) serve(ctx context.Context, client *ssh.Client) error {
+	for _, f := range t.forwards {
+		if f.Kind != ForwardRemote {
+			continue
+		}
+
+		l, err := client.Listen("tcp", f.Listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s on the host: %w", f.Listen, err)
+		}
+
+		// The listener is closed with the client.
+		go t.serveRemote(l, f)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if !keepAlive(client) {
+				return nil
+			}
+		}
+	}
+}
+
+// keepAlive reports whether the host still answers on client.
+func keepAlive(client *ssh.Client) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-time.After(keepAliveInterval):
+		return false
+	}
+}
+
+func (t *Tunnel) setClient(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.client = client
+}
+
+// dial connects to addr through the host.
+func (t *Tunnel) dial(addr string) (net.Conn, error) {
+	t.mu.Lock()
+	client := t.client
+	t.mu.Unlock()
+
+	if client == nil {
+		return nil, errors.New("not connected")
+	}
+
+	return client.Dial("tcp", addr)
+}
+
+func (t *Tunnel) serveLocal(l net.Listener, f Forward) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			if f.Kind == ForwardDynamic {
+				t.handleSocks(conn)
+				return
+			}
+
+			remote, err := t.dial(f.Target)
+			if err != nil {
+				t.log("failed to forward connection", "to", f.Target, "err", err)
+				return
+			}
+			defer remote.Close()
+
+			pipe(conn, remote)
+		}()
+	}
+}
+
+func (t *Tunnel) handleSocks(conn net.Conn) {
+	addr, err := socksHandshake(conn)
+	if err != nil {
+		t.log("SOCKS handshake failed", "from", conn.RemoteAddr(), "err", err)
+		return
+	}
+
+	remote, err := t.dial(addr)
+	if err != nil {
+		socksReply(conn, socksGeneralFailure)
+		t.log("failed to forward connection", "to", addr, "err", err)
+		return
+	}
+	defer remote.Close()
+
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return
+	}
+
+	pipe(conn, remote)
+}
+
+func (t *Tunnel) serveRemote(l net.Listener, f Forward) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			local, err := net.Dial("tcp", f.Target)
+			if err != nil {
+				t.log("failed to forward connection", "to", f.Target, "err", err)
+				return
+			}
+			defer local.Close()
+
+			pipe(conn, local)
+		}()
+	}
+}
+
+func (t *Tunnel) log(msg string, args ...any) {
+	if t.logger != nil {
+		t.logger.Info(msg, args...)
+	}
+}
+
+// pipe copies data between a and b until both directions are done.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		closeWrite(dst)
+	}
+
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+
+	wg.Wait()
+}
+
+// closeWrite signals the end of the data sent to conn, closing it if it
+// cannot be half closed.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+
+	_ = conn.Close()
+}
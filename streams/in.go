@@ -3,6 +3,8 @@ package streams
 import (
 	"io"
 	"os"
+
+	"golang.org/x/term"
 )
 
 type In struct {
@@ -27,3 +29,8 @@ func (i *In) Read(p []byte) (n int, err error) {
 func (i *In) Close() error {
 	return i.in.Close()
 }
+
+// ReadPassword reads a line of input without echoing it.
+func (i *In) ReadPassword() ([]byte, error) {
+	return term.ReadPassword(i.fd)
+}
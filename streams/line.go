@@ -0,0 +1,110 @@
+package streams
+
+import (
+	"bytes"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+)
+
+// prefixColors are the ANSI colors used for prefixes. Red is left out so it
+// is not mistaken for errors.
+var prefixColors = []string{
+	"\x1b[32m", // green
+	"\x1b[33m", // yellow
+	"\x1b[34m", // blue
+	"\x1b[35m", // magenta
+	"\x1b[36m", // cyan
+	"\x1b[92m", // bright green
+	"\x1b[93m", // bright yellow
+	"\x1b[94m", // bright blue
+	"\x1b[95m", // bright magenta
+	"\x1b[96m", // bright cyan
+}
+
+const colorReset = "\x1b[0m"
+
+// LineWriter writes to an Out prefixing every line exactly once. Partial
+// lines are buffered until they are completed or the writer is closed, so
+// output of concurrent writers sharing the Out is never mixed within a line.
+type LineWriter struct {
+	out    *Out
+	prefix string
+
+	// Timestamps adds the time a line was completed after the prefix.
+	Timestamps bool
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// LineWriter returns a writer prefixing every line with prefix. When the
+// output is a terminal, the prefix is colored; the color is derived from
+// color, usually the host name, so it is stable between runs.
+func (o *Out) LineWriter(prefix, color string) *LineWriter {
+	if o.IsTerminal() && os.Getenv("NO_COLOR") == "" {
+		prefix = PrefixColor(color) + prefix + colorReset
+	}
+
+	return &LineWriter{
+		out:    o,
+		prefix: prefix,
+	}
+}
+
+// PrefixColor returns the ANSI color assigned to name.
+func PrefixColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+
+	return prefixColors[h.Sum32()%uint32(len(prefixColors))]
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := w.writeLine(w.buf.Next(i + 1)); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close writes a pending partial line, terminated by a newline.
+func (w *LineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	line := append(w.buf.Bytes(), '\n')
+	w.buf.Reset()
+
+	return w.writeLine(line)
+}
+
+func (w *LineWriter) writeLine(line []byte) error {
+	var b bytes.Buffer
+
+	b.WriteString(w.prefix)
+	if w.Timestamps {
+		b.WriteString(time.Now().Format("15:04:05.000 "))
+	}
+	b.Write(line)
+
+	_, err := w.out.Write(b.Bytes())
+	return err
+}
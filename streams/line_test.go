@@ -0,0 +1,183 @@
+package streams
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		// want is the output after each write, and after Close.
+		want []string
+	}{
+		{
+			name:   "complete lines",
+			writes: []string{"a\n", "b\n"},
+			want:   []string{"h: a\n", "h: a\nh: b\n", "h: a\nh: b\n"},
+		},
+		{
+			name:   "multi-line chunk",
+			writes: []string{"a\nb\nc\n"},
+			want:   []string{"h: a\nh: b\nh: c\n", "h: a\nh: b\nh: c\n"},
+		},
+		{
+			name:   "line split across chunks",
+			writes: []string{"a\nb", "c", "d\ne\n"},
+			want:   []string{"h: a\n", "h: a\n", "h: a\nh: bcd\nh: e\n", "h: a\nh: bcd\nh: e\n"},
+		},
+		{
+			name:   "partial line flushed on close",
+			writes: []string{"a\npartial"},
+			want:   []string{"h: a\n", "h: a\nh: partial\n"},
+		},
+		{
+			name:   "empty lines",
+			writes: []string{"\n\n"},
+			want:   []string{"h: \nh: \n", "h: \nh: \n"},
+		},
+		{
+			name:   "nothing written",
+			writes: nil,
+			want:   []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewOut(&buf).LineWriter("h: ", "h")
+
+			for i, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+
+				if got := buf.String(); got != tt.want[i] {
+					t.Errorf("after Write(%q) output = %q, want %q", s, got, tt.want[i])
+				}
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want[len(tt.want)-1]
+			if got := buf.String(); got != want {
+				t.Errorf("after Close output = %q, want %q", got, want)
+			}
+
+			// A second Close has nothing left to write.
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != want {
+				t.Errorf("after second Close output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLineWriterTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewOut(&buf).LineWriter("h: ", "h")
+	w.Timestamps = true
+
+	w.Write([]byte("a\nb"))
+	w.Close()
+
+	re := regexp.MustCompile(`^h: \d{2}:\d{2}:\d{2}\.\d{3} a\nh: \d{2}:\d{2}:\d{2}\.\d{3} b\n$`)
+	if got := buf.String(); !re.MatchString(got) {
+		t.Errorf("output = %q, want timestamps after the prefix", got)
+	}
+}
+
+func TestLineWriterColors(t *testing.T) {
+	// Output that is not a terminal is never colored.
+	var plain bytes.Buffer
+	w := NewOut(&plain).LineWriter("h: ", "h")
+	w.Write([]byte("a\n"))
+
+	if got := plain.String(); got != "h: a\n" {
+		t.Errorf("output = %q, want no colors", got)
+	}
+
+	color := PrefixColor("deathstar")
+	if color != PrefixColor("deathstar") {
+		t.Error("PrefixColor is not stable")
+	}
+
+	found := false
+	for _, c := range prefixColors {
+		found = found || c == color
+	}
+	if !found {
+		t.Errorf("PrefixColor returned %q, not one of the prefix colors", color)
+	}
+
+	for _, c := range prefixColors {
+		if c == "\x1b[31m" || c == "\x1b[91m" {
+			t.Errorf("prefix colors include red %q", c)
+		}
+	}
+
+	// The colored prefix is written once per line, reset before the line.
+	var colored bytes.Buffer
+	w = &LineWriter{
+		out:    NewOut(&colored),
+		prefix: color + "deathstar: " + colorReset,
+	}
+	w.Write([]byte("a\nb\n"))
+
+	want := color + "deathstar: " + colorReset + "a\n" + color + "deathstar: " + colorReset + "b\n"
+	if got := colored.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestLineWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewOut(&buf)
+
+	const writers, lines = 8, 100
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			w := out.LineWriter(fmt.Sprintf("w%d: ", i), "")
+			defer w.Close()
+
+			// Write every line in two chunks, so that writers interleave
+			// within lines.
+			for j := 0; j < lines; j++ {
+				line := fmt.Sprintf("line %d of writer %d\n", j, i)
+				w.Write([]byte(line[:5]))
+				w.Write([]byte(line[5:]))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(got) != writers*lines {
+		t.Fatalf("got %d lines, want %d", len(got), writers*lines)
+	}
+
+	re := regexp.MustCompile(`^w(\d+): line \d+ of writer (\d+)$`)
+	for _, line := range got {
+		m := re.FindStringSubmatch(line)
+		if m == nil || m[1] != m[2] {
+			t.Errorf("mixed line %q", line)
+		}
+	}
+}
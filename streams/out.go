@@ -9,26 +9,29 @@ import (
 type Out struct {
 	stream
 
-	out    io.Writer
-	outMu  *sync.Mutex
-	prefix string
+	out   io.Writer
+	outMu *sync.Mutex
 }
 
 func NewOut(out io.Writer) *Out {
-	return &Out{
+	o := &Out{
 		out:   out,
 		outMu: &sync.Mutex{},
 	}
+
+	if f, ok := out.(*os.File); ok {
+		o.fd = int(f.Fd())
+	} else {
+		o.fd = -1
+	}
+
+	return o
 }
 
 func (o *Out) Write(p []byte) (n int, err error) {
 	o.outMu.Lock()
 	defer o.outMu.Unlock()
 
-	if o.prefix != "" {
-		prefixedData := append([]byte(o.prefix), p...)
-		return o.out.Write(prefixedData)
-	}
 	return o.out.Write(p)
 }
 
@@ -38,15 +41,6 @@ func (o *Out) SetOutput(out io.Writer) {
 	o.out = out
 }
 
-func (o *Out) WithPrefix(prefix string) *Out {
-	return &Out{
-		stream: o.stream,
-		out:    o.out,
-		outMu:  o.outMu,
-		prefix: o.prefix + prefix,
-	}
-}
-
 var (
 	// StdOut is the standard output stream.
 	StdOut = NewOut(os.Stdout)
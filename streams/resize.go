@@ -0,0 +1,19 @@
+package streams
+
+import "context"
+
+// WatchSize calls fn with the new size of the terminal whenever it is
+// resized, until ctx is done.
+func (s *stream) WatchSize(ctx context.Context, fn func(width, height int)) {
+	width, height, _ := s.Size()
+
+	for range sizeChanges(ctx) {
+		w, h, err := s.Size()
+		if err != nil || (w == width && h == height) {
+			continue
+		}
+
+		width, height = w, h
+		fn(width, height)
+	}
+}
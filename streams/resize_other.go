@@ -0,0 +1,40 @@
+//go:build !unix
+
+package streams
+
+import (
+	"context"
+	"time"
+)
+
+// resizePollInterval is how often the size of the terminal is checked on
+// systems without SIGWINCH.
+const resizePollInterval = 250 * time.Millisecond
+
+// sizeChanges returns a channel receiving a value when the terminal may have
+// been resized. It is closed once ctx is done. Without SIGWINCH, the size is
+// polled.
+func sizeChanges(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{})
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				select {
+				case changes <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes
+}
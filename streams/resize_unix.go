@@ -0,0 +1,38 @@
+//go:build unix
+
+package streams
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// sizeChanges returns a channel receiving a value when the terminal may have
+// been resized. It is closed once ctx is done.
+func sizeChanges(ctx context.Context) <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	changes := make(chan struct{})
+	go func() {
+		defer close(changes)
+		defer signal.Stop(sigs)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				select {
+				case changes <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes
+}